@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// RunSummary describes a completed run of a job
+type RunSummary struct {
+	Status   string    `json:"status"`
+	ExitCode int       `json:"exitCode"`
+	Attempt  int       `json:"attempt"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// NewRunSummary summarizes the result of a run
+func NewRunSummary(result JobResult, start, end time.Time) RunSummary {
+	summary := RunSummary{
+		Status:   result.Status(),
+		ExitCode: result.ExitCode,
+		Attempt:  result.Attempt,
+		Start:    start,
+		End:      end,
+	}
+
+	if result.Err != nil {
+		summary.Error = result.Err.Error()
+	}
+
+	return summary
+}
+
+// JobInfo describes a scheduled job
+type JobInfo struct {
+	Name        string `json:"name"`
+	UniqueName  string `json:"uniqueName"`
+	Type        string `json:"type"`
+	ContainerID string `json:"containerId"`
+	Schedule    string `json:"schedule"`
+	// ScheduleFormat is the format the schedule is parsed in
+	ScheduleFormat string `json:"scheduleFormat"`
+	// Timezone is the timezone the schedule is in. Empty for local time
+	Timezone    string      `json:"timezone,omitempty"`
+	Next        *time.Time  `json:"next,omitempty"`
+	Prev        *time.Time  `json:"prev,omitempty"`
+	Paused      bool        `json:"paused"`
+	PausedUntil *time.Time  `json:"pausedUntil,omitempty"`
+	LastResult  *RunSummary `json:"lastResult,omitempty"`
+	Dependencies
+}
+
+// NewJobInfo describes the job scheduled in a cron entry
+func NewJobInfo(entry cron.Entry) JobInfo {
+	info := newJobInfo(entryJob(entry))
+
+	if !entry.Next.IsZero() {
+		info.Next = &entry.Next
+	}
+
+	if !entry.Prev.IsZero() {
+		info.Prev = &entry.Prev
+	}
+
+	return info
+}
+
+// NewPausedJobInfo describes a paused job
+func NewPausedJobInfo(paused pausedJob) JobInfo {
+	info := newJobInfo(paused.job)
+	info.Paused = true
+
+	if !paused.until.IsZero() {
+		info.PausedUntil = &paused.until
+	}
+
+	return info
+}
+
+// newJobInfo describes the parts of a job that do not depend on its schedule
+func newJobInfo(job ContainerCronJob) JobInfo {
+	info := JobInfo{
+		Name:           job.Name(),
+		UniqueName:     job.UniqueName(),
+		Type:           job.Type(),
+		ContainerID:    job.ContainerID(),
+		Schedule:       job.Schedule(),
+		ScheduleFormat: scheduleFormat(),
+		Timezone:       job.Timezone(),
+		Dependencies:   job.Dependencies(),
+	}
+
+	if record, ok := history.Last(job.UniqueName()); ok {
+		info.LastResult = &record.RunSummary
+	}
+
+	return info
+}
+
+// apiError is the body of an error response from the API
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// API serves information about scheduled jobs over HTTP
+type API struct {
+	cron *cron.Cron
+}
+
+// NewAPI creates an API for jobs scheduled on the given cron
+func NewAPI(c *cron.Cron) *API {
+	return &API{cron: c}
+}
+
+// HandleListJobs responds with all scheduled, paused and triggered jobs
+func (api *API) HandleListJobs(w http.ResponseWriter, _ *http.Request) {
+	jobs := []JobInfo{}
+	for _, entry := range api.cron.Entries() {
+		jobs = append(jobs, NewJobInfo(entry))
+	}
+
+	for _, paused := range pausedJobs.list() {
+		jobs = append(jobs, NewPausedJobInfo(paused))
+	}
+
+	for _, job := range jobGraph.unscheduled() {
+		jobs = append(jobs, newJobInfo(job))
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Name < jobs[j].Name
+	})
+
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// HandleGetJob responds with a single scheduled, paused or triggered job,
+// identified by name or unique name
+func (api *API) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	if entry, ok := api.findEntry(name); ok {
+		writeJSON(w, http.StatusOK, NewJobInfo(entry))
+
+		return
+	}
+
+	if paused, ok := pausedJobs.find(name); ok {
+		writeJSON(w, http.StatusOK, NewPausedJobInfo(paused))
+
+		return
+	}
+
+	if job, ok := jobGraph.findUnscheduled(name); ok {
+		writeJSON(w, http.StatusOK, newJobInfo(job))
+
+		return
+	}
+
+	writeJSON(w, http.StatusNotFound, apiError{"job not found"})
+}
+
+// HandleListRuns responds with the recorded runs of jobs with a name or
+// unique name, newest first. The number of runs can be limited with the
+// limit query parameter
+func (api *API) HandleListRuns(w http.ResponseWriter, r *http.Request) {
+	runs := history.Runs(r.PathValue("name"))
+
+	if val := r.URL.Query().Get("limit"); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit < 0 {
+			writeJSON(w, http.StatusBadRequest, apiError{fmt.Sprintf("invalid limit %q", val)})
+
+			return
+		}
+
+		runs = runs[:min(limit, len(runs))]
+	}
+
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// HandlePauseJob pauses a job until it is resumed. If a duration is given
+// with the for query parameter, the job is resumed automatically after it
+func (api *API) HandlePauseJob(w http.ResponseWriter, r *http.Request) {
+	until := time.Time{}
+
+	if val := r.URL.Query().Get("for"); val != "" {
+		duration, err := time.ParseDuration(val)
+		if err != nil || duration <= 0 {
+			writeJSON(w, http.StatusBadRequest, apiError{fmt.Sprintf("invalid pause duration %q", val)})
+
+			return
+		}
+
+		until = time.Now().Add(duration)
+	}
+
+	job, err := PauseJob(api.cron, r.PathValue("name"), until)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, apiError{err.Error()})
+
+		return
+	}
+
+	if paused, ok := pausedJobs.find(job.UniqueName()); ok {
+		writeJSON(w, http.StatusOK, NewPausedJobInfo(paused))
+	} else {
+		writeJSON(w, http.StatusOK, newJobInfo(job))
+	}
+}
+
+// HandleResumeJob resumes a paused job
+func (api *API) HandleResumeJob(w http.ResponseWriter, r *http.Request) {
+	job, err := ResumeJob(api.cron, r.PathValue("name"))
+
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		writeJSON(w, http.StatusNotFound, apiError{err.Error()})
+
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, apiError{err.Error()})
+
+		return
+	}
+
+	if entry, ok := api.findEntry(job.UniqueName()); ok {
+		writeJSON(w, http.StatusOK, NewJobInfo(entry))
+	} else {
+		writeJSON(w, http.StatusOK, newJobInfo(job))
+	}
+}
+
+// HandleRunJob runs a scheduled job immediately, streaming its output and
+// then its result as newline delimited JSON. Paused jobs and jobs triggered
+// by other jobs may also be run
+func (api *API) HandleRunJob(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	var job ContainerCronJob
+
+	if entry, ok := api.findEntry(name); ok {
+		job = entryJob(entry)
+	} else if paused, ok := pausedJobs.find(name); ok {
+		job = paused.job
+	} else if unscheduled, ok := jobGraph.findUnscheduled(name); ok {
+		job = unscheduled
+	} else {
+		writeJSON(w, http.StatusNotFound, apiError{"job not found"})
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &runStream{w: w, encoder: json.NewEncoder(w)}
+	start := time.Now()
+	result := jobRunner{job}.RunNow(stream)
+
+	stream.Close(NewRunSummary(result, start, time.Now()))
+}
+
+// findEntry finds the cron entry for a job by name or unique name
+func (api *API) findEntry(name string) (cron.Entry, bool) {
+	for _, entry := range api.cron.Entries() {
+		if jobMatches(entryJob(entry), name) {
+			return entry, true
+		}
+	}
+
+	return cron.Entry{}, false
+}
+
+// jobMatches checks if a job has the given name or unique name. As container
+// names start with a slash, the leading slash is optional
+func jobMatches(job ContainerCronJob, name string) bool {
+	name = strings.TrimPrefix(name, "/")
+
+	return strings.TrimPrefix(job.Name(), "/") == name ||
+		strings.TrimPrefix(job.UniqueName(), "/") == name
+}
+
+// runEvent is a single line of the response to a manually triggered run
+type runEvent struct {
+	Output *string     `json:"output,omitempty"`
+	Result *RunSummary `json:"result,omitempty"`
+}
+
+// runStream writes the output of a manually triggered run to an HTTP
+// response as it is received
+type runStream struct {
+	lock    sync.Mutex
+	w       http.ResponseWriter
+	encoder *json.Encoder
+	closed  bool
+}
+
+// Write sends a line of output. Output received after the stream is closed,
+// such as from an interrupted exec, is dropped
+func (stream *runStream) Write(p []byte) (int, error) {
+	line := strings.TrimSuffix(string(p), "\n")
+	stream.send(runEvent{Output: &line}, false)
+
+	return len(p), nil
+}
+
+// Close sends the result of the run and closes the stream
+func (stream *runStream) Close(summary RunSummary) {
+	stream.send(runEvent{Result: &summary}, true)
+}
+
+// send writes an event and flushes it to the client
+func (stream *runStream) send(event runEvent, last bool) {
+	stream.lock.Lock()
+	defer stream.lock.Unlock()
+
+	if stream.closed {
+		return
+	}
+
+	stream.closed = last
+
+	if err := stream.encoder.Encode(event); err != nil {
+		logDebugf("Could not write run output to client: %v", err)
+
+		return
+	}
+
+	if flusher, ok := stream.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/net/context"
+)
+
+// getJSON requests a path from a handler and decodes the response
+func getJSON(t *testing.T, handler http.Handler, path string, value interface{}) int {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if err := json.Unmarshal(recorder.Body.Bytes(), value); err != nil {
+		t.Fatalf("Could not decode response %q: %v", recorder.Body.String(), err)
+	}
+
+	return recorder.Code
+}
+
+// TestJobsAPI checks that scheduled jobs and their last results are listed
+func TestJobsAPI(t *testing.T) {
+	defer func(h *History) {
+		history = h
+	}(history)
+
+	history = NewHistory(defaultHistoryMaxRuns, 0)
+	croner := cron.New()
+
+	startJob := ContainerStartJob{
+		name:        "start_job",
+		containerID: "start_job",
+		schedule:    "* * * * *",
+	}
+	execJob := ContainerExecJob{
+		ContainerStartJob: ContainerStartJob{
+			name:        "exec_job",
+			containerID: "container_id",
+			schedule:    "@daily",
+		},
+		shellCommand: "date",
+	}
+
+	ScheduleJobs(croner, []ContainerCronJob{execJob, startJob})
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	observeRun(execJob.ContainerStartJob, JobResult{ExitCode: 1, Attempt: 1}, start, start.Add(time.Second))
+
+	mux := NewServeMux(NewAPI(croner))
+
+	jobs := []JobInfo{}
+	code := getJSON(t, mux, "/jobs", &jobs)
+	ErrorUnequal(t, http.StatusOK, code, "Unexpected status listing jobs")
+
+	if len(jobs) != 2 {
+		t.Fatalf("Expected two jobs, got %+v", jobs)
+	}
+
+	ErrorUnequal(t, "exec_job", jobs[0].Name, "Unexpected job name")
+	ErrorUnequal(t, "exec_job/container_id", jobs[0].UniqueName, "Unexpected unique name")
+	ErrorUnequal(t, "exec", jobs[0].Type, "Unexpected job type")
+	ErrorUnequal(t, "container_id", jobs[0].ContainerID, "Unexpected container id")
+	ErrorUnequal(t, "@daily", jobs[0].Schedule, "Unexpected schedule")
+
+	if jobs[0].LastResult == nil {
+		t.Fatalf("Expected a last result for %s", jobs[0].Name)
+	}
+
+	ErrorUnequal(t, resultFailure, jobs[0].LastResult.Status, "Unexpected last result")
+	ErrorUnequal(t, 1, jobs[0].LastResult.ExitCode, "Unexpected last exit code")
+
+	ErrorUnequal(t, "start_job", jobs[1].Name, "Unexpected job name")
+	ErrorUnequal(t, "start", jobs[1].Type, "Unexpected job type")
+
+	if jobs[1].LastResult != nil {
+		t.Errorf("Expected no last result for %s, got %+v", jobs[1].Name, jobs[1].LastResult)
+	}
+
+	cases := []struct {
+		path         string
+		expectedCode int
+		expectedName string
+	}{
+		{"/jobs/start_job", http.StatusOK, "start_job"},
+		{"/jobs/" + url.PathEscape("exec_job/container_id"), http.StatusOK, "exec_job"},
+		{"/jobs/missing", http.StatusNotFound, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			job := JobInfo{}
+			code := getJSON(t, mux, c.path, &job)
+			ErrorUnequal(t, c.expectedCode, code, "Unexpected status")
+			ErrorUnequal(t, c.expectedName, job.Name, "Unexpected job")
+		})
+	}
+}
+
+// TestRunJobAPI checks that a job can be triggered over HTTP and its output
+// and result streamed back
+func TestRunJobAPI(t *testing.T) {
+	useFastPolling(t)
+
+	client := NewFakeDockerClient()
+	client.FakeResults["ContainerInspect"] = []FakeResult{
+		{runningContainerInfo, nil},
+	}
+	client.FakeResults["ContainerExecCreate"] = []FakeResult{
+		{dockerTypes.IDResponse{ID: "id"}, nil},
+	}
+	client.FakeResults["ContainerExecStart"] = []FakeResult{
+		{nil},
+	}
+	client.FakeResults["ContainerExecInspect"] = []FakeResult{
+		{container.ExecInspect{ExitCode: 0}, nil},
+	}
+
+	croner := cron.New()
+	ScheduleJobs(croner, []ContainerCronJob{
+		ContainerExecJob{
+			ContainerStartJob: ContainerStartJob{
+				client:      client,
+				context:     context.Background(),
+				name:        "exec_job",
+				containerID: "container_id",
+				schedule:    "@daily",
+			},
+			shellCommand: "date",
+		},
+	})
+
+	mux := NewServeMux(NewAPI(croner))
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/jobs/exec_job/run", nil))
+	ErrorUnequal(t, http.StatusOK, recorder.Code, "Unexpected status running job")
+
+	events := []runEvent{}
+
+	scanner := bufio.NewScanner(recorder.Body)
+	for scanner.Scan() {
+		event := runEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Could not decode event %q: %v", scanner.Text(), err)
+		}
+
+		events = append(events, event)
+	}
+
+	if len(events) != 2 || events[0].Output == nil || events[1].Result == nil {
+		t.Fatalf("Expected output and then a result, got %+v", events)
+	}
+
+	ErrorUnequal(t, "Some output from our command", *events[0].Output, "Unexpected output")
+	ErrorUnequal(t, resultSuccess, events[1].Result.Status, "Unexpected result")
+
+	recorder = httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/jobs/missing/run", nil))
+	ErrorUnequal(t, http.StatusNotFound, recorder.Code, "Unexpected status running missing job")
+}
+
+// useAPIToken sets the token required by the API for the duration of a test
+func useAPIToken(t *testing.T, token string) {
+	t.Helper()
+
+	previous := apiToken
+	apiToken = token
+
+	t.Cleanup(func() {
+		apiToken = previous
+	})
+}
+
+// TestRunJobAPIToken checks that jobs can only be run with the API token, if
+// one is set
+func TestRunJobAPIToken(t *testing.T) {
+	useAPIToken(t, "secret")
+
+	mux := NewServeMux(NewAPI(cron.New()))
+
+	cases := []struct {
+		header string
+		code   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusNotFound},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/jobs/missing/run", nil)
+		if c.header != "" {
+			req.Header.Set("Authorization", c.header)
+		}
+
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, req)
+		ErrorUnequal(t, c.code, recorder.Code, "Unexpected status with authorization "+c.header)
+	}
+
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	ErrorUnequal(t, http.StatusOK, recorder.Code, "Expected jobs to be listed without a token")
+}
+
+// TestRunJobRemote checks that the run command runs jobs on a running
+// dockron and only reports it as unreachable if it can't connect
+func TestRunJobRemote(t *testing.T) {
+	useFastPolling(t)
+
+	client := NewFakeDockerClient()
+	client.FakeResults["ContainerInspect"] = []FakeResult{
+		{runningContainerInfo, nil},
+	}
+	client.FakeResults["ContainerExecCreate"] = []FakeResult{
+		{dockerTypes.IDResponse{ID: "id"}, nil},
+	}
+	client.FakeResults["ContainerExecStart"] = []FakeResult{
+		{nil},
+	}
+	client.FakeResults["ContainerExecInspect"] = []FakeResult{
+		{container.ExecInspect{ExitCode: 2}, nil},
+	}
+
+	croner := cron.New()
+	ScheduleJobs(croner, []ContainerCronJob{
+		ContainerExecJob{
+			ContainerStartJob: ContainerStartJob{
+				client:      client,
+				context:     context.Background(),
+				name:        "exec_job",
+				containerID: "container_id",
+				schedule:    "@daily",
+			},
+			shellCommand: "date",
+		},
+	})
+
+	server := httptest.NewServer(NewServeMux(NewAPI(croner)))
+	defer server.Close()
+
+	// The token is sent by the command as well as required by the API
+	useAPIToken(t, "secret")
+
+	httpAddr := strings.TrimPrefix(server.URL, "http://")
+	output := strings.Builder{}
+
+	summary, err := runJobRemote(httpAddr, "exec_job", &output)
+	if err != nil {
+		t.Fatalf("Unexpected error running job: %v", err)
+	}
+
+	ErrorUnequal(t, "Some output from our command\n", output.String(), "Unexpected output")
+	ErrorUnequal(t, resultFailure, summary.Status, "Unexpected result")
+	ErrorUnequal(t, 2, summary.ExitCode, "Unexpected exit code")
+
+	_, err = runJobRemote(httpAddr, "missing", &output)
+	if !errors.Is(err, ErrAPIRequest) || errors.Is(err, ErrDaemonUnreachable) {
+		t.Errorf("Expected a failed request for a missing job, got %v", err)
+	}
+
+	server.Close()
+
+	_, err = runJobRemote(httpAddr, "exec_job", &output)
+	if !errors.Is(err, ErrDaemonUnreachable) {
+		t.Errorf("Expected dockron to be unreachable, got %v", err)
+	}
+}
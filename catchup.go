@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// CatchupPolicy determines what happens to runs that were missed while
+// dockron was not running or the job was not scheduled
+type CatchupPolicy string
+
+const (
+	// CatchupNone skips all missed runs. This is the default
+	CatchupNone CatchupPolicy = "none"
+	// CatchupOnce runs the job once if any runs were missed
+	CatchupOnce CatchupPolicy = "once"
+	// CatchupAll runs the job once for each missed run, up to a maximum
+	CatchupAll CatchupPolicy = "all"
+)
+
+// defaultCatchupMax is the maximum number of missed runs caught up by default
+const defaultCatchupMax = 10
+
+// parseCatchupPolicy parses the value of a catchup label
+func parseCatchupPolicy(val string) (CatchupPolicy, error) {
+	policy := CatchupPolicy(val)
+
+	switch policy {
+	case CatchupNone, CatchupOnce, CatchupAll:
+		return policy, nil
+	default:
+		return "", fmt.Errorf(
+			"%w: catchup %q must be one of none, once or all",
+			ErrInvalidLabel,
+			val,
+		)
+	}
+}
+
+// missedRuns returns the times the job was scheduled to run since it last
+// ran on its schedule and before now that should be caught up according to
+// its catchup policy. The job must have run at least once. If the container
+// was recreated, the last run of a job with the same name is used
+func (job ContainerStartJob) missedRuns(now time.Time) []time.Time {
+	if job.catchup == "" || job.catchup == CatchupNone {
+		return nil
+	}
+
+	last, ok := history.LastScheduled(job.UniqueName())
+	if !ok {
+		last, ok = history.LastScheduledByName(job.Name())
+	}
+
+	if !ok {
+		return nil
+	}
+
+	schedule, err := job.CronSchedule()
+	if err != nil {
+		return nil
+	}
+
+	limit := 1
+	if job.catchup == CatchupAll {
+		limit = job.catchupMax
+		if limit == 0 {
+			limit = defaultCatchupMax
+		}
+	}
+
+	// Keep the most recent missed runs up to the limit
+	missed := []time.Time{}
+	for next := schedule.Next(last.Start); !next.After(now); next = schedule.Next(next) {
+		missed = append(missed, next)
+		if len(missed) > limit {
+			missed = missed[1:]
+		}
+	}
+
+	return missed
+}
+
+// catchUp runs the job in the background once for each missed run
+func (job ContainerStartJob) catchUp(runOnce func(context.Context) JobResult) {
+	missed := job.missedRuns(time.Now())
+	if len(missed) == 0 {
+		return
+	}
+
+	job.trigger = triggerCatchup
+
+	go func() {
+		for i, scheduled := range missed {
+			logInfof(
+				"%s: Catching up missed run scheduled at %s (%d of %d)",
+				job.name,
+				scheduled.Format(time.RFC3339),
+				i+1,
+				len(missed),
+			)
+
+			job.run(runOnce)
+		}
+	}()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"golang.org/x/net/context"
+)
+
+// TestMissedRuns checks which missed runs are caught up for each policy
+func TestMissedRuns(t *testing.T) {
+	defer func(h *History) {
+		history = h
+	}(history)
+
+	lastRun := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	now := lastRun.Add(3*time.Hour + 30*time.Minute)
+
+	history = NewHistory(defaultHistoryMaxRuns, 0)
+	history.Record(RunRecord{
+		Name:       "job",
+		UniqueName: "job/container",
+		Trigger:    triggerSchedule,
+		RunSummary: RunSummary{Start: lastRun, End: lastRun},
+	})
+	// Older containers of the job should not count when it is recreated
+	history.Record(RunRecord{
+		Name:       "job",
+		UniqueName: "job/old_container",
+		Trigger:    triggerSchedule,
+		RunSummary: RunSummary{Start: lastRun.Add(-2 * time.Hour), End: lastRun.Add(-2 * time.Hour)},
+	})
+	// Manual runs should not count as the last scheduled run
+	history.Record(RunRecord{
+		Name:       "job",
+		UniqueName: "job/container",
+		Trigger:    triggerManual,
+		RunSummary: RunSummary{Start: now, End: now},
+	})
+
+	cases := []struct {
+		name     string
+		job      ContainerStartJob
+		expected []time.Time
+	}{
+		{
+			name:     "Default policy",
+			job:      ContainerStartJob{name: "job", containerID: "container", schedule: "0 * * * *"},
+			expected: nil,
+		},
+		{
+			name:     "Once",
+			job:      ContainerStartJob{name: "job", containerID: "container", schedule: "0 * * * *", catchup: CatchupOnce},
+			expected: []time.Time{lastRun.Add(3 * time.Hour)},
+		},
+		{
+			name: "All",
+			job:  ContainerStartJob{name: "job", containerID: "container", schedule: "0 * * * *", catchup: CatchupAll},
+			expected: []time.Time{
+				lastRun.Add(1 * time.Hour),
+				lastRun.Add(2 * time.Hour),
+				lastRun.Add(3 * time.Hour),
+			},
+		},
+		{
+			name: "All with max",
+			job: ContainerStartJob{
+				name:        "job",
+				containerID: "container",
+				schedule:    "0 * * * *",
+				catchup:     CatchupAll,
+				catchupMax:  2,
+			},
+			expected: []time.Time{lastRun.Add(2 * time.Hour), lastRun.Add(3 * time.Hour)},
+		},
+		{
+			name:     "Nothing missed",
+			job:      ContainerStartJob{name: "job", containerID: "container", schedule: "@daily", catchup: CatchupAll},
+			expected: []time.Time{},
+		},
+		{
+			name: "Recreated container",
+			job:  ContainerStartJob{name: "job", containerID: "new_container", schedule: "0 * * * *", catchup: CatchupAll},
+			expected: []time.Time{
+				lastRun.Add(1 * time.Hour),
+				lastRun.Add(2 * time.Hour),
+				lastRun.Add(3 * time.Hour),
+			},
+		},
+		{
+			name:     "Never run",
+			job:      ContainerStartJob{name: "other", containerID: "container", schedule: "0 * * * *", catchup: CatchupAll},
+			expected: nil,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := c.job.missedRuns(now)
+			if !reflect.DeepEqual(c.expected, actual) {
+				t.Errorf("Expected missed runs %v but got %v", c.expected, actual)
+			}
+		})
+	}
+}
+
+// TestCatchUpOnSchedule checks that missed runs are caught up when a job is
+// scheduled and recorded as catch up runs
+func TestCatchUpOnSchedule(t *testing.T) {
+	defer func(h *History) {
+		history = h
+	}(history)
+
+	useFastPolling(t)
+
+	lastRun := time.Now().Add(-10 * time.Minute)
+
+	history = NewHistory(defaultHistoryMaxRuns, 0)
+	history.Record(RunRecord{
+		Name:       "start_job",
+		UniqueName: "start_job/start_job",
+		Trigger:    triggerSchedule,
+		RunSummary: RunSummary{Start: lastRun, End: lastRun},
+	})
+
+	client := NewFakeDockerClient()
+	client.FakeResults["ContainerInspect"] = []FakeResult{
+		{stoppedContainerInfo, nil},
+		{stoppedContainerInfo, nil},
+		{stoppedContainerInfo, nil},
+		{stoppedContainerInfo, nil},
+	}
+	client.FakeResults["ContainerStart"] = []FakeResult{
+		{nil},
+		{nil},
+	}
+
+	ScheduleJobs(cron.New(), []ContainerCronJob{
+		ContainerStartJob{
+			client:      client,
+			context:     context.Background(),
+			name:        "start_job",
+			containerID: "start_job",
+			schedule:    "* * * * *",
+			catchup:     CatchupAll,
+			catchupMax:  2,
+		},
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(history.Runs("start_job")) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	runs := history.Runs("start_job")
+	if len(runs) != 3 {
+		t.Fatalf("Expected the last scheduled run and two catch up runs, got %+v", runs)
+	}
+
+	ErrorUnequal(t, triggerCatchup, runs[0].Trigger, "Unexpected trigger")
+	ErrorUnequal(t, triggerCatchup, runs[1].Trigger, "Unexpected trigger")
+	ErrorUnequal(t, 2, len(client.FakeCalls["ContainerStart"]), "Expected container to be started for each missed run")
+}
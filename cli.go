@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+var (
+	// apiClientTimeout is the maximum time to wait for a response from the
+	// API of a running dockron
+	apiClientTimeout = (30 * time.Second)
+	// apiDialTimeout is the maximum time to wait to connect to the API of a
+	// running dockron
+	apiDialTimeout = (5 * time.Second)
+)
+
+// runCommand runs the job named in args once and returns the exit code for
+// dockron. The job is run by the dockron listening on httpAddr so its
+// concurrency policy applies and the run is recorded in its history. If no
+// dockron can be reached, the job is found and run by this process instead
+func runCommand(client ContainerClient, httpAddr string, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: dockron [flags] run <job-name>")
+
+		return 2
+	}
+
+	summary, err := runJobRemote(httpAddr, args[0], os.Stdout)
+	if errors.Is(err, ErrDaemonUnreachable) {
+		logWarningf("Running %s in this process as no running dockron was found: %v", args[0], err)
+
+		summary, err = runJobLocal(client, args[0], os.Stdout)
+	}
+
+	if err != nil {
+		logErrorf("Could not run %s: %v", args[0], err)
+
+		return 1
+	}
+
+	if summary.Error != "" {
+		logErrorf("%s: %s", args[0], summary.Error)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: %s (exit code %d)\n", args[0], summary.Status, summary.ExitCode)
+
+	if summary.Status != resultSuccess {
+		return 1
+	}
+
+	return 0
+}
+
+// runJobLocal finds and runs a job in this process, writing its output to
+// output
+func runJobLocal(client ContainerClient, name string, output io.Writer) (RunSummary, error) {
+	start := time.Now()
+
+	result, err := RunJobNow(client, name, output)
+	if err != nil {
+		return RunSummary{}, err
+	}
+
+	return NewRunSummary(result, start, time.Now()), nil
+}
+
+// runJobRemote runs a job on the dockron listening on httpAddr, writing its
+// output to output as it is received
+func runJobRemote(httpAddr, name string, output io.Writer) (RunSummary, error) {
+	// Runs may take a long time, so only the connection is limited
+	resp, err := postJob(httpAddr, name, "run", url.Values{}, 0)
+	if err != nil {
+		return RunSummary{}, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+
+	for {
+		event := runEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			return RunSummary{}, fmt.Errorf("%w: run ended without a result: %w", ErrAPIRequest, err)
+		}
+
+		if event.Output != nil {
+			fmt.Fprintln(output, *event.Output)
+		}
+
+		if event.Result != nil {
+			return *event.Result, nil
+		}
+	}
+}
+
+// pauseCommand pauses the job named in args on a running dockron, optionally
+// for a duration, and returns the exit code for dockron
+func pauseCommand(httpAddr string, args []string) int {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Fprintln(os.Stderr, "Usage: dockron -http-addr <addr> pause <job-name> [duration]")
+
+		return 2
+	}
+
+	query := url.Values{}
+	if len(args) == 2 {
+		query.Set("for", args[1])
+	}
+
+	info, err := postJobAction(httpAddr, args[0], "pause", query)
+	if err != nil {
+		logErrorf("Could not pause %s: %v", args[0], err)
+
+		return 1
+	}
+
+	if info.PausedUntil != nil {
+		fmt.Printf("Paused %s until %s\n", info.Name, info.PausedUntil.Format(time.RFC3339))
+	} else {
+		fmt.Printf("Paused %s\n", info.Name)
+	}
+
+	return 0
+}
+
+// resumeCommand resumes the job named in args on a running dockron and
+// returns the exit code for dockron
+func resumeCommand(httpAddr string, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: dockron -http-addr <addr> resume <job-name>")
+
+		return 2
+	}
+
+	info, err := postJobAction(httpAddr, args[0], "resume", url.Values{})
+	if err != nil {
+		logErrorf("Could not resume %s: %v", args[0], err)
+
+		return 1
+	}
+
+	fmt.Printf("Resumed %s\n", info.Name)
+
+	return 0
+}
+
+// postJobAction sends an action for a job to the API of a running dockron
+// and returns the updated job
+func postJobAction(httpAddr, name, action string, query url.Values) (JobInfo, error) {
+	resp, err := postJob(httpAddr, name, action, query, apiClientTimeout)
+	if err != nil {
+		return JobInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	info := JobInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return JobInfo{}, fmt.Errorf("could not decode response: %w", err)
+	}
+
+	return info, nil
+}
+
+// postJob sends an action for a job to the API of a running dockron and
+// returns the successful response. The timeout of the request is unlimited
+// if 0
+func postJob(httpAddr, name, action string, query url.Values, timeout time.Duration) (*http.Response, error) {
+	baseURL, err := apiURL(httpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unique names contain a slash, so the name must be escaped as one segment
+	target := baseURL
+	target.Path = "/jobs/" + name + "/" + action
+	target.RawPath = "/jobs/" + url.PathEscape(name) + "/" + action
+	target.RawQuery = query.Encode()
+
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{DialContext: (&net.Dialer{Timeout: apiDialTimeout}).DialContext},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target.String(), http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAPIRequest, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+apiToken)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDaemonUnreachable, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+
+		body := apiError{}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+
+		return nil, fmt.Errorf("%w: %s: %s", ErrAPIRequest, resp.Status, body.Error)
+	}
+
+	return resp, nil
+}
+
+// apiURL returns the base URL of the API of a dockron listening on httpAddr.
+// If no host is given, localhost is used
+func apiURL(httpAddr string) (*url.URL, error) {
+	if httpAddr == "" {
+		return nil, fmt.Errorf("%w: -http-addr of the running dockron is required", ErrDaemonUnreachable)
+	}
+
+	host, port, err := net.SplitHostPort(httpAddr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid -http-addr %q: %w", ErrAPIRequest, httpAddr, err)
+	}
+
+	if host == "" {
+		host = "localhost"
+	}
+
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(host, port)}, nil
+}
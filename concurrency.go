@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// ConcurrencyPolicy determines what happens when a job is triggered while a
+// previous run of the same job is still in progress
+type ConcurrencyPolicy string
+
+const (
+	// ConcurrencyAllow runs the job alongside any runs in progress. This is
+	// the default. Start jobs will still be skipped if their container is
+	// already running
+	ConcurrencyAllow ConcurrencyPolicy = "allow"
+	// ConcurrencyForbid skips the new run if a run is in progress
+	ConcurrencyForbid ConcurrencyPolicy = "forbid"
+	// ConcurrencyQueue waits for the run in progress to finish first
+	ConcurrencyQueue ConcurrencyPolicy = "queue"
+	// ConcurrencyReplace cancels the run in progress and then runs
+	ConcurrencyReplace ConcurrencyPolicy = "replace"
+)
+
+// jobRuns tracks runs in progress for all jobs
+var jobRuns = newRunRegistry()
+
+// parseConcurrencyPolicy parses the value of a concurrency label
+func parseConcurrencyPolicy(val string) (ConcurrencyPolicy, error) {
+	policy := ConcurrencyPolicy(val)
+
+	switch policy {
+	case ConcurrencyAllow, ConcurrencyForbid, ConcurrencyQueue, ConcurrencyReplace:
+		return policy, nil
+	default:
+		return "", fmt.Errorf(
+			"%w: concurrency %q must be one of allow, forbid, queue or replace",
+			ErrInvalidLabel,
+			val,
+		)
+	}
+}
+
+// jobRunState tracks runs in progress for a single job
+type jobRunState struct {
+	// lock is held by the exclusive run of a job
+	lock sync.Mutex
+	// cancel cancels the run currently holding the lock
+	cancel context.CancelFunc
+	// users counts the runs waiting on or holding this state
+	users int
+}
+
+// runRegistry tracks runs in progress by job unique name
+type runRegistry struct {
+	lock   sync.Mutex
+	states map[string]*jobRunState
+}
+
+// newRunRegistry creates an empty runRegistry
+func newRunRegistry() *runRegistry {
+	return &runRegistry{states: map[string]*jobRunState{}}
+}
+
+// acquire waits for a job to be allowed to run according to the provided
+// policy. If the run is allowed, a context that is cancelled if the run is
+// replaced is returned along with a function that must be called once the
+// run is complete. If the run should be skipped, ok is false
+func (registry *runRegistry) acquire(
+	uniqueName string,
+	policy ConcurrencyPolicy,
+) (runCtx context.Context, release func(), ok bool) {
+	if policy == "" || policy == ConcurrencyAllow {
+		runCtx, cancel := context.WithCancel(context.Background())
+
+		return runCtx, cancel, true
+	}
+
+	state := registry.get(uniqueName)
+
+	switch policy {
+	case ConcurrencyForbid:
+		if !state.lock.TryLock() {
+			registry.put(uniqueName)
+
+			return nil, nil, false
+		}
+	case ConcurrencyReplace:
+		registry.cancelCurrent(state)
+		state.lock.Lock()
+	case ConcurrencyQueue:
+		state.lock.Lock()
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+
+	registry.lock.Lock()
+	state.cancel = cancel
+	registry.lock.Unlock()
+
+	release = func() {
+		cancel()
+
+		registry.lock.Lock()
+		state.cancel = nil
+		registry.lock.Unlock()
+
+		state.lock.Unlock()
+		registry.put(uniqueName)
+	}
+
+	return runCtx, release, true
+}
+
+// get returns the state for a job, creating it if needed
+func (registry *runRegistry) get(uniqueName string) *jobRunState {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	state, ok := registry.states[uniqueName]
+	if !ok {
+		state = &jobRunState{}
+		registry.states[uniqueName] = state
+	}
+
+	state.users++
+
+	return state
+}
+
+// put releases a reference to the state for a job, removing it once unused
+func (registry *runRegistry) put(uniqueName string) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	state := registry.states[uniqueName]
+
+	state.users--
+	if state.users == 0 {
+		delete(registry.states, uniqueName)
+	}
+}
+
+// cancelCurrent cancels the run in progress for a job, if any
+func (registry *runRegistry) cancelCurrent(state *jobRunState) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if state.cancel != nil {
+		state.cancel()
+	}
+}
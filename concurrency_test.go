@@ -0,0 +1,204 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"golang.org/x/net/context"
+)
+
+// newConcurrencyTestJob creates an exec job that runs to completion on the
+// first status check
+func newConcurrencyTestJob(policy ConcurrencyPolicy) (ContainerExecJob, *FakeDockerClient) {
+	client := &FakeDockerClient{
+		FakeResults: map[string][]FakeResult{
+			"ContainerInspect": {
+				{runningContainerInfo, nil},
+			},
+			"ContainerExecCreate": {
+				{dockerTypes.IDResponse{ID: "id"}, nil},
+			},
+			"ContainerExecStart": {
+				{nil},
+			},
+			"ContainerExecInspect": {
+				{container.ExecInspect{Running: false}, nil},
+			},
+		},
+	}
+
+	job := ContainerExecJob{
+		ContainerStartJob: ContainerStartJob{
+			name:        "test_job",
+			client:      client,
+			containerID: "container_id",
+			concurrency: policy,
+		},
+		shellCommand: "true",
+	}
+
+	return job, client
+}
+
+// runInBackground runs a job and returns a channel that is closed when done
+func runInBackground(job ContainerCronJob) <-chan bool {
+	done := make(chan bool)
+
+	go func() {
+		jobRunner{job}.Run()
+		close(done)
+	}()
+
+	return done
+}
+
+// assertBlocked checks that a background run has not finished yet
+func assertBlocked(t *testing.T, done <-chan bool) {
+	t.Helper()
+
+	select {
+	case <-done:
+		t.Fatal("Expected run to wait for the run in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestConcurrencyPolicies checks how jobs behave when triggered while a
+// previous run is still in progress
+func TestConcurrencyPolicies(t *testing.T) {
+	useFastPolling(t)
+
+	t.Run("Allow runs alongside", func(t *testing.T) {
+		job, client := newConcurrencyTestJob(ConcurrencyAllow)
+
+		_, release, ok := jobRuns.acquire(job.UniqueName(), ConcurrencyForbid)
+		if !ok {
+			t.Fatal("Could not acquire job")
+		}
+		defer release()
+
+		jobRunner{job}.Run()
+
+		ErrorUnequal(t, 1, len(client.FakeCalls["ContainerExecStart"]), "Expected exec to start")
+	})
+
+	t.Run("Forbid skips", func(t *testing.T) {
+		job, client := newConcurrencyTestJob(ConcurrencyForbid)
+
+		_, release, ok := jobRuns.acquire(job.UniqueName(), ConcurrencyForbid)
+		if !ok {
+			t.Fatal("Could not acquire job")
+		}
+		defer release()
+
+		jobRunner{job}.Run()
+
+		ErrorUnequal(t, 0, len(client.FakeCalls), "Expected no Docker calls")
+	})
+
+	t.Run("Queue waits", func(t *testing.T) {
+		job, client := newConcurrencyTestJob(ConcurrencyQueue)
+
+		runCtx, release, ok := jobRuns.acquire(job.UniqueName(), ConcurrencyQueue)
+		if !ok {
+			t.Fatal("Could not acquire job")
+		}
+
+		done := runInBackground(job)
+		assertBlocked(t, done)
+
+		if runCtx.Err() != nil {
+			t.Error("Expected run in progress not to be cancelled")
+		}
+
+		release()
+		<-done
+
+		ErrorUnequal(t, 1, len(client.FakeCalls["ContainerExecStart"]), "Expected exec to start")
+	})
+
+	t.Run("Replace cancels", func(t *testing.T) {
+		job, client := newConcurrencyTestJob(ConcurrencyReplace)
+
+		runCtx, release, ok := jobRuns.acquire(job.UniqueName(), ConcurrencyReplace)
+		if !ok {
+			t.Fatal("Could not acquire job")
+		}
+
+		done := runInBackground(job)
+
+		select {
+		case <-runCtx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("Expected run in progress to be cancelled")
+		}
+
+		assertBlocked(t, done)
+		release()
+		<-done
+
+		ErrorUnequal(t, 1, len(client.FakeCalls["ContainerExecStart"]), "Expected exec to start")
+	})
+
+	if len(jobRuns.states) != 0 {
+		t.Errorf("Expected all run states to be released. Found %+v", jobRuns.states)
+	}
+}
+
+// TestExecJobReplaced checks that a cancelled exec run is killed
+func TestExecJobReplaced(t *testing.T) {
+	defer func(runID func() string) {
+		newRunID = runID
+	}(newRunID)
+
+	newRunID = func() string { return "run_id" }
+
+	client := &FakeDockerClient{
+		FakeResults: map[string][]FakeResult{
+			"ContainerInspect": {
+				{runningContainerInfo, nil},
+			},
+			"ContainerExecCreate": {
+				{dockerTypes.IDResponse{ID: "id"}, nil},
+				{dockerTypes.IDResponse{ID: "kill_id"}, nil},
+			},
+			"ContainerExecStart": {
+				{nil},
+				{nil},
+			},
+			"ContainerExecInspect": {
+				{container.ExecInspect{}, nil},
+				{container.ExecInspect{ExitCode: 137}, nil},
+			},
+		},
+	}
+
+	job := ContainerExecJob{
+		ContainerStartJob: ContainerStartJob{
+			name:        "test_job",
+			client:      client,
+			containerID: "container_id",
+			concurrency: ConcurrencyReplace,
+		},
+		shellCommand: "sleep 100",
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := job.runOnce(runCtx)
+	ErrorUnequal(t, JobResult{Cancelled: true}, result, "Unexpected result")
+
+	if result.Failed() {
+		t.Error("Expected cancelled run not to be considered failed")
+	}
+
+	execCreates := client.FakeCalls["ContainerExecCreate"]
+	ErrorUnequal(t, 2, len(execCreates), "Expected a kill exec to be created")
+
+	if options, ok := execCreates[0][2].(container.ExecOptions); !ok || len(options.Env) != 1 {
+		t.Errorf("Expected exec to be tagged with a run ID. Got %+v", execCreates[0][2])
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// triggerDependency is the source of a run triggered by another job
+const triggerDependency = "dependency"
+
+// jobGraph tracks the dependencies between all known jobs
+var jobGraph = newDependencyRegistry()
+
+// Dependencies are the names of other jobs that trigger a job when they
+// finish
+type Dependencies struct {
+	// After are the jobs that trigger this job whenever they finish
+	After []string `json:"after,omitempty"`
+	// OnSuccess are the jobs that trigger this job when they succeed
+	OnSuccess []string `json:"onSuccess,omitempty"`
+	// OnFailure are the jobs that trigger this job when they fail
+	OnFailure []string `json:"onFailure,omitempty"`
+}
+
+// hasDependencies checks if a map of label fields to values configures any
+// dependencies, in which case the job does not need a schedule
+func hasDependencies(config map[string]string) bool {
+	for _, field := range []string{"after", "on_success", "on_failure"} {
+		if _, ok := config[field]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseJobNames parses the value of a label holding a comma separated list
+// of job names
+func parseJobNames(field, val string) (string, error) {
+	for _, name := range strings.Split(val, ",") {
+		if strings.TrimSpace(name) == "" {
+			return "", fmt.Errorf("%w: %s %q must be a comma separated list of job names", ErrInvalidLabel, field, val)
+		}
+	}
+
+	return val, nil
+}
+
+// splitJobNames splits a comma separated list of job names
+func splitJobNames(val string) []string {
+	if val == "" {
+		return nil
+	}
+
+	names := strings.Split(val, ",")
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+	}
+
+	return names
+}
+
+// matchesAny checks if a job matches any of the given names
+func matchesAny(job ContainerCronJob, names []string) bool {
+	for _, name := range names {
+		if jobMatches(job, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// triggers checks if a job may trigger another when it finishes
+func triggers(from, to ContainerCronJob) bool {
+	deps := to.Dependencies()
+
+	return matchesAny(from, deps.After) || matchesAny(from, deps.OnSuccess) || matchesAny(from, deps.OnFailure)
+}
+
+// dependencyRegistry tracks known jobs by unique name so they can be
+// triggered by the jobs they depend on
+type dependencyRegistry struct {
+	lock sync.Mutex
+	jobs map[string]ContainerCronJob
+}
+
+// newDependencyRegistry creates an empty dependencyRegistry
+func newDependencyRegistry() *dependencyRegistry {
+	return &dependencyRegistry{jobs: map[string]ContainerCronJob{}}
+}
+
+// update replaces the known jobs matching inScope with the provided jobs.
+// Provided jobs that would be part of a cycle of dependencies are left out
+// and their unique names are returned
+func (registry *dependencyRegistry) update(jobs []ContainerCronJob, inScope func(ContainerCronJob) bool) map[string]bool {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for uniqueName, job := range registry.jobs {
+		if inScope(job) {
+			delete(registry.jobs, uniqueName)
+		}
+	}
+
+	all := make([]ContainerCronJob, 0, len(registry.jobs)+len(jobs))
+	for _, job := range registry.jobs {
+		all = append(all, job)
+	}
+
+	all = append(all, jobs...)
+	cyclic := cyclicJobs(all)
+
+	for _, job := range jobs {
+		if !cyclic[job.UniqueName()] {
+			registry.jobs[job.UniqueName()] = job
+		}
+	}
+
+	return cyclic
+}
+
+// unscheduled returns the known jobs without a schedule, which only run when
+// triggered by another job. Paused jobs are left out
+func (registry *dependencyRegistry) unscheduled() []ContainerCronJob {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	jobs := []ContainerCronJob{}
+
+	for _, job := range registry.jobs {
+		if _, paused := pausedJobs.find(job.UniqueName()); !paused && job.Schedule() == "" {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return jobs
+}
+
+// findUnscheduled returns a job without a schedule by name or unique name
+func (registry *dependencyRegistry) findUnscheduled(name string) (ContainerCronJob, bool) {
+	for _, job := range registry.unscheduled() {
+		if jobMatches(job, name) {
+			return job, true
+		}
+	}
+
+	return nil, false
+}
+
+// dependents returns the known jobs triggered by a job finishing with the
+// given result
+func (registry *dependencyRegistry) dependents(job ContainerCronJob, result JobResult) []ContainerCronJob {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	dependents := []ContainerCronJob{}
+
+	for _, uniqueName := range sortedKeys(registry.jobs) {
+		other := registry.jobs[uniqueName]
+		deps := other.Dependencies()
+
+		switch {
+		case matchesAny(job, deps.After),
+			result.Status() == resultSuccess && matchesAny(job, deps.OnSuccess),
+			result.Failed() && matchesAny(job, deps.OnFailure):
+			dependents = append(dependents, other)
+		}
+	}
+
+	return dependents
+}
+
+// cyclicJobs returns the unique names of jobs that would trigger themselves
+// through their dependencies
+func cyclicJobs(jobs []ContainerCronJob) map[string]bool {
+	edges := map[string][]string{}
+
+	for _, from := range jobs {
+		for _, to := range jobs {
+			if triggers(from, to) {
+				edges[from.UniqueName()] = append(edges[from.UniqueName()], to.UniqueName())
+			}
+		}
+	}
+
+	cyclic := map[string]bool{}
+
+	for _, job := range jobs {
+		if reaches(edges, job.UniqueName(), job.UniqueName(), map[string]bool{}) {
+			cyclic[job.UniqueName()] = true
+		}
+	}
+
+	return cyclic
+}
+
+// reaches checks if target can be reached by following edges from a job
+func reaches(edges map[string][]string, from, target string, visited map[string]bool) bool {
+	for _, next := range edges[from] {
+		if next == target {
+			return true
+		}
+
+		if !visited[next] {
+			visited[next] = true
+
+			if reaches(edges, next, target, visited) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Dependencies returns the names of jobs that trigger the job
+func (job ContainerStartJob) Dependencies() Dependencies {
+	return Dependencies{
+		After:     splitJobNames(job.after),
+		OnSuccess: splitJobNames(job.onSuccess),
+		OnFailure: splitJobNames(job.onFailure),
+	}
+}
+
+// triggerDependents runs the jobs triggered by the job finishing with the
+// given result in the background. Paused jobs are not triggered
+func (job ContainerStartJob) triggerDependents(result JobResult) {
+	if result.Skipped {
+		return
+	}
+
+	for _, dependent := range jobGraph.dependents(job, result) {
+		if _, ok := pausedJobs.find(dependent.UniqueName()); ok {
+			logInfof("%s: Not triggering %s as it is paused", job.name, dependent.Name())
+
+			continue
+		}
+
+		logInfof("%s: Triggering %s after %s run", job.name, dependent.Name(), result.Status())
+
+		go jobRunner{dependent}.RunDependent()
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/net/context"
+)
+
+// dependentJob creates a start job for a container that exits with the given
+// code after one run
+func dependentJob(name string, exitCode int) ContainerStartJob {
+	client := NewFakeDockerClient()
+	client.FakeResults["ContainerInspect"] = []FakeResult{
+		{stoppedContainerInfo, nil},
+		{dockerTypes.ContainerJSON{
+			ContainerJSONBase: &dockerTypes.ContainerJSONBase{
+				State: &dockerTypes.ContainerState{Running: false, ExitCode: exitCode},
+			},
+		}, nil},
+	}
+	client.FakeResults["ContainerStart"] = []FakeResult{
+		{nil},
+	}
+
+	return ContainerStartJob{
+		client:      client,
+		context:     context.Background(),
+		name:        "/" + name,
+		containerID: name,
+	}
+}
+
+// TestCyclicJobs checks that only jobs that would trigger themselves are
+// found to be in a cycle
+func TestCyclicJobs(t *testing.T) {
+	jobs := []ContainerCronJob{
+		ContainerStartJob{name: "/a", containerID: "a", after: "c"},
+		ContainerStartJob{name: "/b", containerID: "b", onSuccess: "a"},
+		ContainerStartJob{name: "/c", containerID: "c", onFailure: "/b"},
+		ContainerStartJob{name: "/d", containerID: "d", after: "a"},
+		ContainerStartJob{name: "/e", containerID: "e", after: "e"},
+		ContainerStartJob{name: "/f", containerID: "f", schedule: "* * * * *"},
+		ContainerExecJob{ContainerStartJob: ContainerStartJob{name: "/f/g", containerID: "f", after: "f, d"}},
+	}
+
+	cyclic := []string{}
+	for uniqueName := range cyclicJobs(jobs) {
+		cyclic = append(cyclic, uniqueName)
+	}
+
+	sort.Strings(cyclic)
+
+	ErrorUnequal(t, "[/a/a /b/b /c/c /e/e]", fmtStrings(cyclic), "Unexpected cyclic jobs")
+}
+
+// fmtStrings formats a list of strings in sorted order for comparison
+func fmtStrings(values []string) string {
+	sort.Strings(values)
+
+	return fmt.Sprint(values)
+}
+
+// useEmptyJobGraph clears the jobs known to have dependencies before and
+// after a test
+func useEmptyJobGraph(t *testing.T) {
+	t.Helper()
+
+	clearGraph := func() {
+		jobGraph.update(nil, func(ContainerCronJob) bool { return true })
+	}
+
+	clearGraph()
+	t.Cleanup(clearGraph)
+}
+
+// TestScheduleDependentJobs checks that jobs without a schedule are tracked
+// but not scheduled and that jobs in a cycle are not scheduled at all
+func TestScheduleDependentJobs(t *testing.T) {
+	useEmptyJobGraph(t)
+
+	croner := cron.New()
+
+	ScheduleJobs(croner, []ContainerCronJob{
+		ContainerStartJob{name: "/extract", containerID: "extract", schedule: "0 * * * *", after: "load"},
+		ContainerStartJob{name: "/transform", containerID: "transform", after: "extract"},
+		ContainerStartJob{name: "/load", containerID: "load", onSuccess: "transform"},
+		ContainerStartJob{name: "/report", containerID: "report", schedule: "0 0 * * *"},
+		ContainerStartJob{name: "/notify", containerID: "notify", onFailure: "report"},
+	})
+
+	ErrorUnequal(t, "[/report/report]", fmtStrings(sortedUniqueNames(croner)), "Unexpected scheduled jobs")
+
+	unscheduled := []string{}
+	for _, job := range jobGraph.unscheduled() {
+		unscheduled = append(unscheduled, job.UniqueName())
+	}
+
+	ErrorUnequal(t, "[/notify/notify]", fmtStrings(unscheduled), "Unexpected unscheduled jobs")
+
+	// Breaking the cycle schedules the jobs again
+	ScheduleJobs(croner, []ContainerCronJob{
+		ContainerStartJob{name: "/extract", containerID: "extract", schedule: "0 * * * *"},
+		ContainerStartJob{name: "/transform", containerID: "transform", after: "extract"},
+		ContainerStartJob{name: "/load", containerID: "load", onSuccess: "transform"},
+	})
+
+	ErrorUnequal(t, "[/extract/extract]", fmtStrings(sortedUniqueNames(croner)), "Unexpected scheduled jobs")
+	ErrorUnequal(t, 2, len(jobGraph.unscheduled()), "Expected two unscheduled jobs")
+}
+
+// TestTriggerDependents checks that finishing a job triggers the jobs that
+// depend on its result
+func TestTriggerDependents(t *testing.T) {
+	useFastPolling(t)
+
+	useEmptyJobGraph(t)
+
+	defer func(h *History) {
+		history = h
+	}(history)
+
+	history = NewHistory(defaultHistoryMaxRuns, 0)
+
+	extract := dependentJob("extract", 0)
+	extract.schedule = "0 * * * *"
+
+	transform := dependentJob("transform", 1)
+	transform.onSuccess = "extract"
+
+	cleanup := dependentJob("cleanup", 0)
+	cleanup.onFailure = "extract"
+
+	alert := dependentJob("alert", 0)
+	alert.onFailure = "transform"
+
+	report := dependentJob("report", 0)
+	report.after = "transform"
+
+	ScheduleJobs(cron.New(), []ContainerCronJob{extract, transform, cleanup, alert, report})
+
+	jobRunner{extract}.Run()
+
+	expected := []string{"/alert/alert", "/extract/extract", "/report/report", "/transform/transform"}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(historyNames()) < len(expected) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Give any unexpected runs a chance to be recorded
+	time.Sleep(50 * time.Millisecond)
+
+	ErrorUnequal(t, fmtStrings(expected), fmtStrings(historyNames()), "Unexpected jobs run")
+
+	for _, name := range []string{"transform", "alert", "report"} {
+		if runs := history.Runs(name); len(runs) == 1 {
+			ErrorUnequal(t, triggerDependency, runs[0].Trigger, "Unexpected trigger for "+name)
+		}
+	}
+}
+
+// historyNames returns the unique names of all jobs in the history
+func historyNames() []string {
+	history.lock.Lock()
+	defer history.lock.Unlock()
+
+	return sortedKeys(history.runs)
+}
@@ -7,6 +7,7 @@ toolchain go1.22.7
 require (
 	git.iamthefij.com/iamthefij/slog v1.3.0
 	github.com/docker/docker v27.3.1+incompatible
+	github.com/opencontainers/image-spec v1.1.0
 	github.com/robfig/cron/v3 v3.0.1
 	golang.org/x/net v0.29.0
 )
@@ -25,7 +26,6 @@ require (
 	github.com/moby/term v0.5.0 // indirect
 	github.com/morikuni/aec v1.0.0 // indirect
 	github.com/opencontainers/go-digest v1.0.0 // indirect
-	github.com/opencontainers/image-spec v1.1.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.55.0 // indirect
 	go.opentelemetry.io/otel v1.30.0 // indirect
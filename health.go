@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// defaultUnhealthyAfter is the number of consecutive failed Docker polls
+// after which dockron is considered unhealthy
+const defaultUnhealthyAfter = 3
+
+// health tracks the health of dockron for all checks
+var health = NewHealth(defaultUnhealthyAfter)
+
+// JobFailure describes a job that could not be scheduled
+type JobFailure struct {
+	Name        string `json:"name"`
+	UniqueName  string `json:"uniqueName"`
+	ContainerID string `json:"containerId"`
+	Schedule    string `json:"schedule"`
+	Error       string `json:"error"`
+}
+
+// HealthStatus is the body returned by health checks
+type HealthStatus struct {
+	Status              string       `json:"status"`
+	Ready               bool         `json:"ready"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	LastError           string       `json:"lastError,omitempty"`
+	FailedJobs          []JobFailure `json:"failedJobs"`
+}
+
+// Health tracks whether dockron can reach Docker and which jobs failed to
+// be scheduled
+type Health struct {
+	lock                sync.Mutex
+	unhealthyAfter      int
+	ready               bool
+	consecutiveFailures int
+	lastError           string
+	failedJobs          map[string]JobFailure
+}
+
+// NewHealth creates a Health that becomes unhealthy after the given number
+// of consecutive failed polls
+func NewHealth(unhealthyAfter int) *Health {
+	return &Health{
+		unhealthyAfter: unhealthyAfter,
+		failedJobs:     map[string]JobFailure{},
+	}
+}
+
+// SetUnhealthyAfter sets the number of consecutive failed polls after which
+// dockron is considered unhealthy
+func (h *Health) SetUnhealthyAfter(unhealthyAfter int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.unhealthyAfter = unhealthyAfter
+}
+
+// ObservePoll records the result of querying Docker, and the jobs file on a
+// full resync, for jobs. The first successful poll marks dockron as ready
+func (h *Health) ObservePoll(err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if err != nil {
+		h.consecutiveFailures++
+		h.lastError = err.Error()
+
+		return
+	}
+
+	h.ready = true
+	h.consecutiveFailures = 0
+	h.lastError = ""
+}
+
+// ClearJobFailures forgets failures for jobs in containers matching inScope
+// so they can be recorded again by a new poll
+func (h *Health) ClearJobFailures(inScope func(containerID string) bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for uniqueName, failure := range h.failedJobs {
+		if inScope(failure.ContainerID) {
+			delete(h.failedJobs, uniqueName)
+		}
+	}
+}
+
+// ObserveJobFailure records a job that could not be scheduled
+func (h *Health) ObserveJobFailure(job ContainerCronJob, err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.failedJobs[job.UniqueName()] = JobFailure{
+		Name:        job.Name(),
+		UniqueName:  job.UniqueName(),
+		ContainerID: job.ContainerID(),
+		Schedule:    job.Schedule(),
+		Error:       err.Error(),
+	}
+}
+
+// Status returns the current health status
+func (h *Health) Status() HealthStatus {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	status := HealthStatus{
+		Status:              "ok",
+		Ready:               h.ready,
+		ConsecutiveFailures: h.consecutiveFailures,
+		LastError:           h.lastError,
+		FailedJobs:          []JobFailure{},
+	}
+
+	if h.unhealthyAfter > 0 && h.consecutiveFailures >= h.unhealthyAfter {
+		status.Status = "unhealthy"
+	}
+
+	for _, uniqueName := range sortedKeys(h.failedJobs) {
+		status.FailedJobs = append(status.FailedJobs, h.failedJobs[uniqueName])
+	}
+
+	return status
+}
+
+// HandleHealthz responds with the health status, failing if Docker has been
+// unreachable for too long
+func (h *Health) HandleHealthz(w http.ResponseWriter, _ *http.Request) {
+	status := h.Status()
+
+	code := http.StatusOK
+	if status.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, status)
+}
+
+// HandleReadyz responds with the health status, failing until the first
+// successful poll of Docker
+func (h *Health) HandleReadyz(w http.ResponseWriter, _ *http.Request) {
+	status := h.Status()
+
+	code := http.StatusOK
+	if !status.Ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, status)
+}
+
+// writeJSON writes a value as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(value)
+}
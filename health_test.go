@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/robfig/cron/v3"
+)
+
+// getHealthStatus requests a health check and decodes the response
+func getHealthStatus(t *testing.T, handler http.HandlerFunc) (int, HealthStatus) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	status := HealthStatus{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Could not decode health status %q: %v", recorder.Body.String(), err)
+	}
+
+	return recorder.Code, status
+}
+
+// TestHealthChecks checks readiness and health as Docker polls succeed or fail
+func TestHealthChecks(t *testing.T) {
+	h := NewHealth(2)
+
+	code, _ := getHealthStatus(t, h.HandleReadyz)
+	ErrorUnequal(t, http.StatusServiceUnavailable, code, "Expected not ready before first poll")
+
+	h.ObservePoll(nil)
+
+	code, _ = getHealthStatus(t, h.HandleReadyz)
+	ErrorUnequal(t, http.StatusOK, code, "Expected ready after first poll")
+
+	h.ObservePoll(errGeneric)
+
+	code, status := getHealthStatus(t, h.HandleHealthz)
+	ErrorUnequal(t, http.StatusOK, code, "Expected healthy after one failure")
+	ErrorUnequal(t, 1, status.ConsecutiveFailures, "Unexpected failure count")
+
+	h.ObservePoll(errGeneric)
+
+	code, status = getHealthStatus(t, h.HandleHealthz)
+	ErrorUnequal(t, http.StatusServiceUnavailable, code, "Expected unhealthy after two failures")
+	ErrorUnequal(t, "unhealthy", status.Status, "Unexpected status")
+	ErrorUnequal(t, errGeneric.Error(), status.LastError, "Unexpected last error")
+
+	code, _ = getHealthStatus(t, h.HandleReadyz)
+	ErrorUnequal(t, http.StatusOK, code, "Expected to remain ready once ready")
+
+	h.ObservePoll(nil)
+
+	code, _ = getHealthStatus(t, h.HandleHealthz)
+	ErrorUnequal(t, http.StatusOK, code, "Expected healthy after recovering")
+}
+
+// TestHealthFailedJobs checks that jobs that fail to schedule are reported
+// until their containers are fixed
+func TestHealthFailedJobs(t *testing.T) {
+	defer func(h *Health) {
+		health = h
+	}(health)
+
+	health = NewHealth(defaultUnhealthyAfter)
+	client := NewFakeDockerClient()
+	croner := cron.New()
+
+	client.FakeResults["ContainerList"] = []FakeResult{
+		{[]dockerTypes.Container{
+			{
+				Names: []string{"bad_timeout"},
+				ID:    "bad_timeout",
+				Labels: map[string]string{
+					"dockron.schedule": "* * * * *",
+					"dockron.timeout":  "soon",
+				},
+			},
+			{
+				Names: []string{"bad_schedule"},
+				ID:    "bad_schedule",
+				Labels: map[string]string{
+					"dockron.schedule": "every minute",
+				},
+			},
+		}, nil},
+		{[]dockerTypes.Container{
+			{
+				Names: []string{"bad_timeout"},
+				ID:    "bad_timeout",
+				Labels: map[string]string{
+					"dockron.schedule": "* * * * *",
+				},
+			},
+		}, nil},
+	}
+
+	if err := Resync(client, croner); err != nil {
+		t.Fatalf("Unexpected error querying jobs: %v", err)
+	}
+
+	code, status := getHealthStatus(t, health.HandleHealthz)
+	ErrorUnequal(t, http.StatusOK, code, "Expected failed jobs not to affect health")
+	ErrorUnequal(t, 2, len(status.FailedJobs), "Expected two failed jobs")
+
+	if len(status.FailedJobs) == 2 {
+		ErrorUnequal(t, "bad_schedule/bad_schedule", status.FailedJobs[0].UniqueName, "Unexpected failed job")
+		ErrorUnequal(t, "every minute", status.FailedJobs[0].Schedule, "Unexpected failed job schedule")
+		ErrorUnequal(t, "bad_timeout/bad_timeout", status.FailedJobs[1].UniqueName, "Unexpected failed job")
+	}
+
+	// Fixing a container clears its failure
+	if err := RescheduleContainer(client, croner, "bad_timeout"); err != nil {
+		t.Fatalf("Unexpected error querying jobs: %v", err)
+	}
+
+	_, status = getHealthStatus(t, health.HandleHealthz)
+	ErrorUnequal(t, 1, len(status.FailedJobs), "Expected one failed job")
+}
+
+// TestHealthJobsFileError checks that a resync is only healthy once the jobs
+// file as well as Docker could be read
+func TestHealthJobsFileError(t *testing.T) {
+	defer func(h *Health, path string) {
+		health = h
+		jobsFile = path
+	}(health, jobsFile)
+
+	health = NewHealth(1)
+	jobsFile = filepath.Join(t.TempDir(), "missing.json")
+	client := NewFakeDockerClient()
+
+	client.FakeResults["ContainerList"] = []FakeResult{
+		{[]dockerTypes.Container{}, nil},
+	}
+
+	if err := Resync(client, cron.New()); err == nil {
+		t.Fatal("Expected an error reading the jobs file")
+	}
+
+	code, _ := getHealthStatus(t, health.HandleReadyz)
+	ErrorUnequal(t, http.StatusServiceUnavailable, code, "Expected dockron not to be ready")
+
+	code, status := getHealthStatus(t, health.HandleHealthz)
+	ErrorUnequal(t, http.StatusServiceUnavailable, code, "Expected dockron to be unhealthy")
+
+	if status.LastError == "" {
+		t.Error("Expected the jobs file error to be reported")
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHistoryMaxRuns is the number of runs kept for each job
+	defaultHistoryMaxRuns = 100
+	// historyOutputLimit is the number of bytes of output kept for each run
+	historyOutputLimit = 4096
+	// historyFileName is the name of the history file in the state directory
+	historyFileName = "history.jsonl"
+	// minHistoryCompaction is the minimum number of stale records in the
+	// history file before it is rewritten
+	minHistoryCompaction = 100
+	// maxHistoryLineSize is the maximum size of a record in the history file
+	maxHistoryLineSize = 1 << 20
+)
+
+// Sources that can trigger a run of a job
+const (
+	triggerSchedule = "schedule"
+	triggerManual   = "manual"
+	triggerCatchup  = "catchup"
+)
+
+// history records the runs of all jobs
+var history = NewHistory(defaultHistoryMaxRuns, 0)
+
+// RunRecord describes a single run of a job kept in the history
+type RunRecord struct {
+	Name        string `json:"name"`
+	UniqueName  string `json:"uniqueName"`
+	ContainerID string `json:"containerId"`
+	Trigger     string `json:"trigger"`
+	RunSummary
+	Output string `json:"output,omitempty"`
+}
+
+// History keeps the most recent runs of each job, optionally appending them
+// to a file so they survive restarts
+type History struct {
+	lock    sync.Mutex
+	path    string
+	maxRuns int
+	maxAge  time.Duration
+	// runs are the records for each job by unique name, oldest first
+	runs map[string][]RunRecord
+	// fileRecords is the number of records in the history file
+	fileRecords int
+}
+
+// NewHistory creates an in-memory History keeping up to maxRuns runs of each
+// job. If maxAge is not zero, older runs are also removed
+func NewHistory(maxRuns int, maxAge time.Duration) *History {
+	return &History{
+		maxRuns: maxRuns,
+		maxAge:  maxAge,
+		runs:    map[string][]RunRecord{},
+	}
+}
+
+// OpenHistory creates a History that is persisted to a file in stateDir,
+// loading any runs already recorded there
+func OpenHistory(stateDir string, maxRuns int, maxAge time.Duration) (*History, error) {
+	h := NewHistory(maxRuns, maxAge)
+	h.path = filepath.Join(stateDir, historyFileName)
+
+	if err := os.MkdirAll(stateDir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create state directory: %w", err)
+	}
+
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.prune(time.Now())
+
+	if err := h.rewrite(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// load reads all records from the history file
+func (h *History) load() error {
+	file, err := os.Open(h.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not open history: %w", err)
+	}
+	defer file.Close()
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxHistoryLineSize)
+
+	for line := 1; scanner.Scan(); line++ {
+		record := RunRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			logWarningf("Skipping invalid record on line %d of %s: %v", line, h.path, err)
+
+			continue
+		}
+
+		h.runs[record.UniqueName] = append(h.runs[record.UniqueName], record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("could not read history: %w", err)
+	}
+
+	return nil
+}
+
+// Observe records the result of a run of a job
+func (h *History) Observe(job ContainerStartJob, result JobResult, start, end time.Time) {
+	h.Record(RunRecord{
+		Name:        job.name,
+		UniqueName:  job.UniqueName(),
+		ContainerID: job.containerID,
+		Trigger:     job.triggerSource(),
+		RunSummary:  NewRunSummary(result, start, end),
+		Output:      result.Output,
+	})
+}
+
+// Record adds a run to the history, removing any runs beyond the retention
+// limits
+func (h *History) Record(record RunRecord) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.runs[record.UniqueName] = append(h.runs[record.UniqueName], record)
+	h.prune(time.Now())
+
+	if h.path == "" {
+		return
+	}
+
+	if err := h.append(record); err != nil {
+		logWarningf("Could not save run of %s to history: %v", record.Name, err)
+	}
+
+	// Rewrite the file once it is mostly made up of pruned records
+	if stale := h.fileRecords - h.count(); stale > minHistoryCompaction && stale > h.count() {
+		if err := h.rewrite(); err != nil {
+			logWarningf("Could not compact history: %v", err)
+		}
+	}
+}
+
+// Runs returns the runs of all jobs with the given name or unique name,
+// newest first
+func (h *History) Runs(name string) []RunRecord {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	runs := []RunRecord{}
+
+	for _, records := range h.runs {
+		if len(records) > 0 && recordMatches(records[0], name) {
+			runs = append(runs, records...)
+		}
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].Start.After(runs[j].Start)
+	})
+
+	return runs
+}
+
+// Last returns the most recent run of a job by unique name, if any
+func (h *History) Last(uniqueName string) (RunRecord, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	records := h.runs[uniqueName]
+	if len(records) == 0 {
+		return RunRecord{}, false
+	}
+
+	return records[len(records)-1], true
+}
+
+// LastScheduled returns the most recent run of a job by unique name that
+// was triggered by its schedule, if any
+func (h *History) LastScheduled(uniqueName string) (RunRecord, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return lastScheduled(h.runs[uniqueName])
+}
+
+// LastScheduledByName returns the most recent run triggered by a schedule of
+// any job with the given name or unique name, if any. This finds runs of a
+// job from before its container was recreated
+func (h *History) LastScheduledByName(name string) (RunRecord, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	last, found := RunRecord{}, false
+
+	for _, records := range h.runs {
+		if len(records) == 0 || !recordMatches(records[0], name) {
+			continue
+		}
+
+		if record, ok := lastScheduled(records); ok && (!found || record.Start.After(last.Start)) {
+			last, found = record, true
+		}
+	}
+
+	return last, found
+}
+
+// lastScheduled returns the most recent of the records that was triggered by
+// a schedule, if any
+func lastScheduled(records []RunRecord) (RunRecord, bool) {
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Trigger == triggerSchedule || records[i].Trigger == triggerCatchup {
+			return records[i], true
+		}
+	}
+
+	return RunRecord{}, false
+}
+
+// prune removes runs beyond the retention limits
+func (h *History) prune(now time.Time) {
+	for uniqueName, records := range h.runs {
+		if h.maxAge > 0 {
+			cutoff := now.Add(-h.maxAge)
+			for len(records) > 0 && records[0].End.Before(cutoff) {
+				records = records[1:]
+			}
+		}
+
+		if h.maxRuns > 0 && len(records) > h.maxRuns {
+			records = records[len(records)-h.maxRuns:]
+		}
+
+		if len(records) == 0 {
+			delete(h.runs, uniqueName)
+		} else {
+			h.runs[uniqueName] = records
+		}
+	}
+}
+
+// count returns the number of runs kept
+func (h *History) count() int {
+	count := 0
+	for _, records := range h.runs {
+		count += len(records)
+	}
+
+	return count
+}
+
+// append adds a record to the end of the history file
+func (h *History) append(record RunRecord) error {
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open history: %w", err)
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(record); err != nil {
+		return fmt.Errorf("could not write history: %w", err)
+	}
+
+	h.fileRecords++
+
+	return nil
+}
+
+// rewrite replaces the history file with only the runs that are kept
+func (h *History) rewrite() error {
+	tmpPath := h.path + ".tmp"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("could not create history: %w", err)
+	}
+
+	records := []RunRecord{}
+	for _, uniqueName := range sortedKeys(h.runs) {
+		records = append(records, h.runs[uniqueName]...)
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Start.Before(records[j].Start)
+	})
+
+	encoder := json.NewEncoder(file)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			file.Close()
+
+			return fmt.Errorf("could not write history: %w", err)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("could not write history: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, h.path); err != nil {
+		return fmt.Errorf("could not replace history: %w", err)
+	}
+
+	h.fileRecords = len(records)
+
+	return nil
+}
+
+// recordMatches checks if a record is for a job with the given name or
+// unique name. As container names start with a slash, the leading slash is
+// optional
+func recordMatches(record RunRecord, name string) bool {
+	name = strings.TrimPrefix(name, "/")
+
+	return strings.TrimPrefix(record.Name, "/") == name ||
+		strings.TrimPrefix(record.UniqueName, "/") == name
+}
+
+// tailBuffer keeps the last bytes written to it up to a limit. It is safe to
+// use from multiple goroutines
+type tailBuffer struct {
+	lock  sync.Mutex
+	limit int
+	data  []byte
+}
+
+// newTailBuffer creates a tailBuffer keeping up to limit bytes
+func newTailBuffer(limit int) *tailBuffer {
+	return &tailBuffer{limit: limit}
+}
+
+// Write appends to the buffer, discarding the oldest bytes beyond the limit
+func (buf *tailBuffer) Write(p []byte) (int, error) {
+	buf.lock.Lock()
+	defer buf.lock.Unlock()
+
+	buf.data = append(buf.data, p...)
+	if len(buf.data) > buf.limit {
+		buf.data = buf.data[len(buf.data)-buf.limit:]
+	}
+
+	return len(p), nil
+}
+
+// String returns the bytes kept in the buffer
+func (buf *tailBuffer) String() string {
+	buf.lock.Lock()
+	defer buf.lock.Unlock()
+
+	return string(buf.data)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/net/context"
+)
+
+// newRecord creates a record for a run of a job that started at the given
+// offset from now
+func newRecord(uniqueName string, offset time.Duration) RunRecord {
+	start := time.Now().Add(offset)
+
+	return RunRecord{
+		Name:       strings.Split(uniqueName, "/")[0],
+		UniqueName: uniqueName,
+		Trigger:    triggerSchedule,
+		RunSummary: RunSummary{Status: resultSuccess, Start: start, End: start},
+	}
+}
+
+// TestHistoryRetention checks that only the most recent runs are kept
+func TestHistoryRetention(t *testing.T) {
+	h := NewHistory(2, time.Hour)
+
+	h.Record(newRecord("job_1/container_1", -3*time.Hour))
+	h.Record(newRecord("job_1/container_1", -3*time.Minute))
+	h.Record(newRecord("job_1/container_1", -2*time.Minute))
+	h.Record(newRecord("job_1/container_1", -1*time.Minute))
+	h.Record(newRecord("job_2/container_2", -2*time.Hour))
+
+	runs := h.Runs("job_1")
+	ErrorUnequal(t, 2, len(runs), "Expected runs beyond the limit to be removed")
+
+	if len(runs) == 2 && !runs[0].Start.After(runs[1].Start) {
+		t.Errorf("Expected newest runs first, got %+v", runs)
+	}
+
+	ErrorUnequal(t, 0, len(h.Runs("job_2")), "Expected old runs to be removed")
+
+	if _, ok := h.Last("job_2/container_2"); ok {
+		t.Errorf("Expected no last run for job with only old runs")
+	}
+}
+
+// TestHistoryPersistence checks that runs are saved and loaded from the
+// state directory
+func TestHistoryPersistence(t *testing.T) {
+	stateDir := t.TempDir()
+
+	h, err := OpenHistory(stateDir, 2, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error opening history: %v", err)
+	}
+
+	for i := 3; i > 0; i-- {
+		h.Record(newRecord("job_1/container_1", -time.Duration(i)*time.Minute))
+	}
+
+	// Invalid lines should be skipped rather than lose the history
+	file, err := os.OpenFile(filepath.Join(stateDir, historyFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("Unexpected error opening history file: %v", err)
+	}
+
+	_, _ = file.WriteString("not json\n")
+	file.Close()
+
+	h, err = OpenHistory(stateDir, 2, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error reopening history: %v", err)
+	}
+
+	ErrorUnequal(t, 2, len(h.Runs("/job_1")), "Expected runs to be loaded")
+
+	// Reopening compacts the file down to the runs that are kept
+	data, err := os.ReadFile(filepath.Join(stateDir, historyFileName))
+	if err != nil {
+		t.Fatalf("Unexpected error reading history file: %v", err)
+	}
+
+	ErrorUnequal(t, 2, strings.Count(string(data), "\n"), "Expected history file to be compacted")
+}
+
+// TestHistoryFromRuns checks that runs of jobs are recorded with their
+// trigger and output
+func TestHistoryFromRuns(t *testing.T) {
+	defer func(h *History) {
+		history = h
+	}(history)
+
+	history = NewHistory(defaultHistoryMaxRuns, 0)
+
+	useFastPolling(t)
+
+	client := NewFakeDockerClient()
+	client.FakeResults["ContainerInspect"] = []FakeResult{
+		{runningContainerInfo, nil},
+	}
+	client.FakeResults["ContainerExecCreate"] = []FakeResult{
+		{dockerTypes.IDResponse{ID: "id"}, nil},
+	}
+	client.FakeResults["ContainerExecStart"] = []FakeResult{
+		{nil},
+	}
+	client.FakeResults["ContainerExecInspect"] = []FakeResult{
+		{container.ExecInspect{ExitCode: 1}, nil},
+	}
+
+	job := ContainerExecJob{
+		ContainerStartJob: ContainerStartJob{
+			client:      client,
+			context:     context.Background(),
+			name:        "exec_job",
+			containerID: "container_id",
+			schedule:    "@daily",
+		},
+		shellCommand: "date",
+	}
+
+	jobRunner{job}.RunNow(nil)
+
+	runs := history.Runs("exec_job")
+	if len(runs) != 1 {
+		t.Fatalf("Expected one recorded run, got %+v", runs)
+	}
+
+	ErrorUnequal(t, triggerManual, runs[0].Trigger, "Unexpected trigger")
+	ErrorUnequal(t, resultFailure, runs[0].Status, "Unexpected status")
+	ErrorUnequal(t, 1, runs[0].ExitCode, "Unexpected exit code")
+	ErrorUnequal(t, "Some output from our command\n", runs[0].Output, "Unexpected output")
+
+	// Output is truncated to the tail
+	output := newTailBuffer(4)
+	_, _ = output.Write([]byte("abc"))
+	_, _ = output.Write([]byte("def"))
+	ErrorUnequal(t, "cdef", output.String(), "Unexpected output tail")
+}
+
+// TestListRunsAPI checks that runs of a job can be listed over HTTP
+func TestListRunsAPI(t *testing.T) {
+	defer func(h *History) {
+		history = h
+	}(history)
+
+	history = NewHistory(defaultHistoryMaxRuns, 0)
+	history.Record(newRecord("job_1/container_1", -2*time.Minute))
+	history.Record(newRecord("job_1/container_1", -1*time.Minute))
+
+	mux := NewServeMux(NewAPI(cron.New()))
+
+	runs := []RunRecord{}
+	code := getJSON(t, mux, "/jobs/job_1/runs", &runs)
+	ErrorUnequal(t, http.StatusOK, code, "Unexpected status listing runs")
+	ErrorUnequal(t, 2, len(runs), "Unexpected number of runs")
+
+	code = getJSON(t, mux, "/jobs/job_1/runs?limit=1", &runs)
+	ErrorUnequal(t, http.StatusOK, code, "Unexpected status listing runs")
+	ErrorUnequal(t, 1, len(runs), "Expected runs to be limited")
+
+	code = getJSON(t, mux, "/jobs/job_1/runs?limit=many", &apiError{})
+	ErrorUnequal(t, http.StatusBadRequest, code, "Expected invalid limit to be rejected")
+}
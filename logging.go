@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"git.iamthefij.com/iamthefij/slog"
+)
+
+// Formats that logs can be written in
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// Levels that messages can be logged at
+const (
+	levelDebug   = "debug"
+	levelInfo    = "info"
+	levelWarning = "warning"
+	levelError   = "error"
+)
+
+// Events describing what happened to a job
+const (
+	eventScheduled = "scheduled"
+	eventStarted   = "started"
+	eventOutput    = "output"
+	eventFinished  = "finished"
+	eventSkipped   = "skipped"
+)
+
+var (
+	// logFormat is the format logs are written in
+	logFormat = logFormatText
+	// logWriter receives logs in the JSON format
+	logWriter io.Writer = os.Stderr
+	// logWriterLock prevents logs in the JSON format from being interleaved
+	logWriterLock sync.Mutex
+)
+
+// Fields are structured data attached to a log message
+type Fields map[string]interface{}
+
+// jobFields returns the fields describing an event for a job
+func jobFields(job ContainerCronJob, event string) Fields {
+	return Fields{
+		"event":        event,
+		"job":          job.Name(),
+		"unique_name":  job.UniqueName(),
+		"container_id": job.ContainerID(),
+	}
+}
+
+// parseLogFormat checks the name of a log format
+func parseLogFormat(format string) (string, error) {
+	switch format {
+	case logFormatText, logFormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: %q must be one of text or json", ErrInvalidLogFormat, format)
+	}
+}
+
+// logEvent logs a message at the given level. In the text format, the
+// message is logged with slog and fields are omitted. In the JSON format, a
+// single object is written with the level, message and fields
+func logEvent(level string, fields Fields, format string, v ...interface{}) {
+	if logFormat != logFormatJSON {
+		switch level {
+		case levelDebug:
+			slog.Debugf(format, v...)
+		case levelInfo:
+			slog.Infof(format, v...)
+		case levelWarning:
+			slog.Warningf(format, v...)
+		default:
+			slog.Errorf(format, v...)
+		}
+
+		return
+	}
+
+	if level == levelDebug && !slog.DebugLevel {
+		return
+	}
+
+	entry := Fields{}
+	for key, value := range fields {
+		entry[key] = value
+	}
+
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["level"] = level
+	entry["msg"] = fmt.Sprintf(format, v...)
+
+	logWriterLock.Lock()
+	defer logWriterLock.Unlock()
+
+	if err := json.NewEncoder(logWriter).Encode(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not write log: %v\n", err)
+	}
+}
+
+// logDebugf logs a debug message
+func logDebugf(format string, v ...interface{}) {
+	logEvent(levelDebug, nil, format, v...)
+}
+
+// logInfof logs an info message
+func logInfof(format string, v ...interface{}) {
+	logEvent(levelInfo, nil, format, v...)
+}
+
+// logWarningf logs a warning message
+func logWarningf(format string, v ...interface{}) {
+	logEvent(levelWarning, nil, format, v...)
+}
+
+// logErrorf logs an error message
+func logErrorf(format string, v ...interface{}) {
+	logEvent(levelError, nil, format, v...)
+}
+
+// logOnErrWarnf logs a warning message if err is not nil
+func logOnErrWarnf(err error, format string, v ...interface{}) {
+	if err != nil {
+		logWarningf(format, v...)
+	}
+}
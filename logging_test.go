@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// captureLogs writes logs in the JSON format for the duration of a test and
+// returns a function to read the logged entries
+func captureLogs(t *testing.T) func() []Fields {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	format, writer := logFormat, logWriter
+	logFormat, logWriter = logFormatJSON, buf
+
+	t.Cleanup(func() {
+		logFormat, logWriter = format, writer
+	})
+
+	return func() []Fields {
+		logWriterLock.Lock()
+		defer logWriterLock.Unlock()
+
+		entries := []Fields{}
+
+		scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+		for scanner.Scan() {
+			entry := Fields{}
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Fatalf("Could not decode log %q: %v", scanner.Text(), err)
+			}
+
+			entries = append(entries, entry)
+		}
+
+		return entries
+	}
+}
+
+// eventEntries returns the logged entries for an event
+func eventEntries(entries []Fields, event string) []Fields {
+	matching := []Fields{}
+
+	for _, entry := range entries {
+		if entry["event"] == event {
+			matching = append(matching, entry)
+		}
+	}
+
+	return matching
+}
+
+// TestJSONLogs checks that events for jobs are logged as JSON objects with
+// structured fields
+func TestJSONLogs(t *testing.T) {
+	readLogs := captureLogs(t)
+
+	job := ContainerStartJob{name: "/job_1", containerID: "container_1", schedule: "* * * * *"}
+	ScheduleJobs(cron.New(), []ContainerCronJob{job})
+	job.logResult(JobResult{ExitCode: 3, Attempt: 1}, 1500*time.Millisecond)
+	logInfof("Plain %s", "message")
+
+	entries := readLogs()
+	if len(entries) != 3 {
+		t.Fatalf("Expected three log entries, got %+v", entries)
+	}
+
+	for _, entry := range entries {
+		if _, ok := entry["time"]; !ok {
+			t.Errorf("Expected a time in entry %+v", entry)
+		}
+
+		delete(entry, "time")
+	}
+
+	expected := []Fields{
+		{
+			"level":           levelInfo,
+			"msg":             "Scheduled /job_1 (/job_1/container_1) with schedule '* * * * *'",
+			"event":           eventScheduled,
+			"job":             "/job_1",
+			"unique_name":     "/job_1/container_1",
+			"container_id":    "container_1",
+			"schedule":        "* * * * *",
+			"schedule_format": scheduleFormatStandard,
+			"type":            "start",
+		},
+		{
+			"level":        levelError,
+			"msg":          "/job_1: Job exited with code 3 on attempt 1",
+			"event":        eventFinished,
+			"job":          "/job_1",
+			"unique_name":  "/job_1/container_1",
+			"container_id": "container_1",
+			"result":       resultFailure,
+			"exit_code":    float64(3),
+			"duration":     1.5,
+			"attempt":      float64(1),
+			"trigger":      triggerSchedule,
+		},
+		{
+			"level": levelInfo,
+			"msg":   "Plain message",
+		},
+	}
+
+	if !reflect.DeepEqual(expected, entries) {
+		t.Errorf("Expected log entries %+v but got %+v", expected, entries)
+	}
+}
+
+// TestParseLogFormat checks the supported log formats
+func TestParseLogFormat(t *testing.T) {
+	for _, format := range []string{logFormatText, logFormatJSON} {
+		if _, err := parseLogFormat(format); err != nil {
+			t.Errorf("Unexpected error parsing %s: %v", format, err)
+		}
+	}
+
+	if _, err := parseLogFormat("xml"); err == nil {
+		t.Errorf("Expected an error parsing an unknown format")
+	}
+}
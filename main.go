@@ -2,32 +2,126 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"git.iamthefij.com/iamthefij/slog"
 	dockerTypes "github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
 	dockerClient "github.com/docker/docker/client"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/robfig/cron/v3"
 	"golang.org/x/net/context"
 )
 
 var (
-	// defaultWatchInterval is the duration we should sleep until polling Docker
+	// defaultWatchInterval is the duration between full resyncs with Docker
 	defaultWatchInterval = (1 * time.Minute)
 
+	// watchedEvents are the container events that may change scheduled jobs
+	watchedEvents = []events.Action{
+		events.ActionCreate,
+		events.ActionDestroy,
+		events.ActionRename,
+		events.ActionUpdate,
+	}
+
+	// scheduleLock serializes changes to the jobs scheduled on the cron
+	scheduleLock sync.Mutex
+
+	// pollInterval is the duration between checks on a running job
+	pollInterval = (1 * time.Second)
+	// execKillChecks is the number of times a killed exec is checked before
+	// giving up on it exiting
+	execKillChecks = 10
+
+	// labelPrefix is the prefix of all labels used to configure dockron
+	labelPrefix = "dockron."
+	// containerLabelFields are the dockron.<field> labels that apply to all
+	// jobs of a container
+	containerLabelFields = []string{"notify.url", "notify.on"}
 	// schedLabel is the string label to search for cron expressions
 	schedLabel = "dockron.schedule"
+	// execLabelFields are patterns matching the fields of exec job labels
+	execLabelFields = []string{
+		"schedule", "command", "timeout", "retries", "retry_delay", "retry_backoff", "concurrency",
+		"catchup", "catchup_max", "ping_url", "timezone", "jitter", "after", "on_success", "on_failure",
+		"user", "workdir", `env\.[a-zA-Z_][a-zA-Z0-9_]*`, "shell", "privileged", "exec",
+		"image", "mounts", "network", "keep", "logs", "signal",
+	}
 	// execLabelRegex is will capture labels for an exec job
-	execLabelRegexp = regexp.MustCompile(`dockron\.([a-zA-Z0-9_-]+)\.(schedule|command)`)
+	execLabelRegexp = regexp.MustCompile(`^dockron\.([a-zA-Z0-9_-]+)\.(` + strings.Join(execLabelFields, "|") + `)$`)
+
+	// defaultShell is the shell and arguments used to run exec commands
+	defaultShell = []string{"sh", "-c"}
+
+	// defaultRetryDelay is the delay before the first retry of a failed job
+	defaultRetryDelay = (10 * time.Second)
+	// defaultRetryBackoff is the multiplier applied to the delay between retries
+	defaultRetryBackoff = 2.0
+	// retryJitter is the maximum fraction of the delay added between retries
+	retryJitter = 0.2
+
+	// minDockerRetryDelay is the initial delay before retrying to query Docker
+	minDockerRetryDelay = (1 * time.Second)
+
+	// httpReadHeaderTimeout is the maximum time to read HTTP request headers
+	httpReadHeaderTimeout = (10 * time.Second)
+
+	// runIDEnvName is the environment variable used to tag exec processes
+	// so they can be killed on timeout
+	runIDEnvName = "DOCKRON_RUN_ID"
+	// execKillScript kills every process in a container whose environment
+	// contains the tag passed as the first argument
+	execKillScript = `for p in /proc/[0-9]*; do ` +
+		`if tr '\0' '\n' < "$p/environ" 2>/dev/null | grep -qxF "$1"; then kill -KILL "${p#/proc/}"; fi; ` +
+		`done`
+
+	// newRunID generates a unique identifier for a single run of a job
+	newRunID = func() string {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
 
 	// version of dockron being run
 	version = "dev"
+
+	// ErrInvalidLabel is returned when a job label has an invalid value
+	ErrInvalidLabel = errors.New("invalid label value")
+	// ErrJobNotFound is returned when no job matches a requested name
+	ErrJobNotFound = errors.New("job not found")
+	// ErrInvalidLogLevel is returned when an unknown log level is given
+	ErrInvalidLogLevel = errors.New("invalid log level")
+	// ErrInvalidLogFormat is returned when an unknown log format is given
+	ErrInvalidLogFormat = errors.New("invalid log format")
+	// ErrAPIRequest is returned when a request to the API of a running
+	// dockron fails
+	ErrAPIRequest = errors.New("api request failed")
+	// ErrDaemonUnreachable is returned when no running dockron can be
+	// reached on its API
+	ErrDaemonUnreachable = errors.New("dockron not reachable")
+	// ErrNotifyFailed is returned when a webhook notification fails
+	ErrNotifyFailed = errors.New("notification failed")
+	// ErrDependencyCycle is returned when a job would trigger itself through
+	// its dependencies
+	ErrDependencyCycle = errors.New("dependency cycle")
+	// ErrExecNotKilled is returned when an interrupted exec job could not be
+	// killed
+	ErrExecNotKilled = errors.New("exec not killed")
 )
 
 // ContainerClient provides an interface for interracting with Docker. Makes it possible to mock in tests
@@ -36,17 +130,109 @@ type ContainerClient interface {
 	ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error)
 	ContainerExecStart(ctx context.Context, execID string, config container.ExecStartOptions) error
 	ContainerExecAttach(ctx context.Context, execID string, options container.ExecAttachOptions) (dockerTypes.HijackedResponse, error)
+	ContainerCreate(
+		ctx context.Context,
+		config *container.Config,
+		hostConfig *container.HostConfig,
+		networkingConfig *network.NetworkingConfig,
+		platform *ocispec.Platform,
+		containerName string,
+	) (container.CreateResponse, error)
 	ContainerInspect(ctx context.Context, containerID string) (dockerTypes.ContainerJSON, error)
+	ContainerKill(ctx context.Context, containerID, signal string) error
 	ContainerList(context context.Context, options container.ListOptions) ([]dockerTypes.Container, error)
+	ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error)
+	ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error
+	ContainerRestart(ctx context.Context, containerID string, options container.StopOptions) error
 	ContainerStart(context context.Context, containerID string, options container.StartOptions) error
+	ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
+	Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error)
+	ImagePull(ctx context.Context, refStr string, options image.PullOptions) (io.ReadCloser, error)
 }
 
-// ContainerCronJob is an interface of a job to run on containers
+// ContainerCronJob is an interface of a job to run on containers. Jobs are
+// run with a jobRunner, which makes each attempt with runOnce
 type ContainerCronJob interface {
-	Run()
 	Name() string
 	UniqueName() string
 	Schedule() string
+	ContainerID() string
+	Timezone() string
+	CronSchedule() (cron.Schedule, error)
+	Dependencies() Dependencies
+	Type() string
+	runOnce(runCtx context.Context) JobResult
+	startJob() ContainerStartJob
+}
+
+// Statuses describing the outcome of a run
+const (
+	resultSuccess   = "success"
+	resultFailure   = "failure"
+	resultTimeout   = "timeout"
+	resultSkipped   = "skipped"
+	resultCancelled = "cancelled"
+	resultError     = "error"
+)
+
+// JobError is returned when a job could not be run because of an error
+// communicating with Docker
+type JobError struct {
+	// Job is the name of the job
+	Job string
+	// Op describes what the job was trying to do
+	Op string
+	// Err is the underlying error
+	Err error
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("%s: could not %s: %v", e.Job, e.Op, e.Err)
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+// JobResult is the outcome of a single run of a job
+type JobResult struct {
+	// ExitCode is the exit code of the container or exec process
+	ExitCode int
+	// TimedOut indicates that the job was killed after exceeding its timeout
+	TimedOut bool
+	// Skipped indicates that the job did not run at all
+	Skipped bool
+	// Cancelled indicates that the run was replaced by a newer run
+	Cancelled bool
+	// Err is set if the run could not be completed because of an error
+	Err error
+	// Attempt is the number of this attempt, starting at 1
+	Attempt int
+	// Output is the tail of the output of the run, if any was captured
+	Output string
+}
+
+// Failed indicates if the run should be considered a failure
+func (result JobResult) Failed() bool {
+	return result.Err != nil || (!result.Skipped && !result.Cancelled && (result.TimedOut || result.ExitCode != 0))
+}
+
+// Status returns a short description of the outcome of a run
+func (result JobResult) Status() string {
+	switch {
+	case result.Err != nil:
+		return resultError
+	case result.Skipped:
+		return resultSkipped
+	case result.Cancelled:
+		return resultCancelled
+	case result.TimedOut:
+		return resultTimeout
+	case result.ExitCode != 0:
+		return resultFailure
+	default:
+		return resultSuccess
+	}
 }
 
 // ContainerStartJob represents a scheduled container task
@@ -58,58 +244,357 @@ type ContainerStartJob struct {
 	name        string
 	containerID string
 	schedule    string
+	timeout     time.Duration
+	retries     int
+	retryDelay  time.Duration
+	// retryBackoff is the multiplier applied to retryDelay after each attempt
+	retryBackoff float64
+	concurrency  ConcurrencyPolicy
+	catchup      CatchupPolicy
+	// catchupMax is the maximum number of missed runs caught up
+	catchupMax int
+	// output receives the output of a manually triggered run, if any. It is
+	// passed to runOnce in the run context
+	output io.Writer
+	// trigger is the source that triggered the run. Defaults to the schedule
+	trigger string
+	// disableLogs skips logging the output of the container after each run
+	disableLogs bool
+	// notifyURL is the webhook notified after runs. Defaults to notifyWebhook
+	notifyURL string
+	notifyOn  NotifyPolicy
+	// pingURL is pinged when each run starts and finishes
+	pingURL string
+	// timezone is the timezone the schedule is in. Defaults to defaultTimezone
+	timezone string
+	// jitter is the maximum delay added to each scheduled run
+	jitter time.Duration
+	// after, onSuccess and onFailure are comma separated names of jobs that
+	// trigger this job when they finish, succeed or fail
+	after     string
+	onSuccess string
+	onFailure string
 }
 
-// Run is executed based on the ContainerStartJob Schedule and starts the
-// container
-func (job ContainerStartJob) Run() {
-	slog.Infof("Starting: %s", job.name)
+// runOnce starts the container and waits for it to exit, stopping it if the
+// run context is done before then
+func (job ContainerStartJob) runOnce(runCtx context.Context) JobResult {
+	logEvent(levelInfo, jobFields(job, eventStarted), "Starting: %s", job.name)
 
 	// Check if container is already running
 	containerJSON, err := job.client.ContainerInspect(
 		job.context,
 		job.containerID,
 	)
-	slog.OnErrPanicf(err, "Could not get container details for job %s", job.name)
+	if err != nil {
+		return job.errorResult("get container details", err)
+	}
 
 	if containerJSON.State.Running {
-		slog.Warningf("%s: Container is already running. Skipping start.", job.name)
+		logEvent(levelWarning, jobFields(job, eventSkipped), "%s: Container is already running. Skipping start.", job.name)
 
-		return
+		return JobResult{Skipped: true}
 	}
 
+	markRunStarted(runCtx)
+
 	// Start job
+	start := time.Now()
 	err = job.client.ContainerStart(
 		job.context,
 		job.containerID,
 		container.StartOptions{},
 	)
-	slog.OnErrPanicf(err, "Could not start container for job %s", job.name)
+	if err != nil {
+		return job.errorResult("start container", err)
+	}
 
 	// Check results of job
 	for check := true; check; check = containerJSON.State.Running {
-		slog.Debugf("%s: Still running", job.name)
+		if err := runCtx.Err(); err != nil {
+			job.stopContainer(err)
+
+			result := interruptedResult(err)
+			result.Output = job.logOutput(runCtx, start)
+
+			return result
+		}
+
+		logDebugf("%s: Still running", job.name)
 
 		containerJSON, err = job.client.ContainerInspect(
 			job.context,
 			job.containerID,
 		)
-		slog.OnErrPanicf(err, "Could not get container details for job %s", job.name)
+		if err != nil {
+			return job.errorResult("get container details", err)
+		}
 
-		time.Sleep(1 * time.Second)
+		time.Sleep(pollInterval)
 	}
-	slog.Debugf("%s: Done running. %+v", job.name, containerJSON.State)
+	logDebugf("%s: Done running. %+v", job.name, containerJSON.State)
 
-	// Log exit code if failed
-	if containerJSON.State.ExitCode != 0 {
-		slog.Errorf(
-			"%s: Exec job exited with code %d",
-			job.name,
-			containerJSON.State.ExitCode,
-		)
+	return JobResult{
+		ExitCode: containerJSON.State.ExitCode,
+		Output:   job.logOutput(runCtx, start),
 	}
 }
 
+// logOutput logs the output of the container since the run started and
+// returns the tail of it. Only up to defaultLogsLimit bytes are read
+func (job ContainerStartJob) logOutput(runCtx context.Context, since time.Time) string {
+	if job.disableLogs {
+		return ""
+	}
+
+	reader, err := job.client.ContainerLogs(job.context, job.containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Since:      since.Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		logWarningf("%s: Could not get container logs: %v", job.name, err)
+
+		return ""
+	}
+	defer reader.Close()
+
+	output := newTailBuffer(historyOutputLimit)
+	stdout := job.outputLines(runCtx, output, "Container output", "stdout", levelInfo)
+	stderr := job.outputLines(runCtx, output, "Container error output", "stderr", stderrLevel)
+
+	err = copyOutput(stdout, stderr, io.LimitReader(reader, defaultLogsLimit))
+	logOnErrWarnf(err, "%s: Error reading container logs: %v", job.name, err)
+
+	stdout.Flush()
+	stderr.Flush()
+
+	if n, _ := reader.Read(make([]byte, 1)); n > 0 {
+		logWarningf("%s: Container output truncated after %d bytes", job.name, defaultLogsLimit)
+	}
+
+	return output.String()
+}
+
+// outputLines returns a writer that logs each line of output from a stream
+// of the job at the given level and writes it to output, as well as to the
+// output of a manually triggered run
+func (job ContainerStartJob) outputLines(runCtx context.Context, output io.Writer, prefix, stream, level string) *lineWriter {
+	fields := jobFields(job, eventOutput)
+	fields["stream"] = stream
+	manualOutput := runOutput(runCtx)
+
+	return newLineWriter(func(line string) {
+		fmt.Fprintln(output, line)
+
+		if manualOutput != nil {
+			fmt.Fprintln(manualOutput, line)
+		}
+
+		if len(line) > 0 {
+			logEvent(level, fields, "%s: %s: %s", job.name, prefix, line)
+		} else {
+			logDebugf("%s: Empty %s", job.name, strings.ToLower(prefix))
+		}
+	})
+}
+
+// errorResult returns the result of a run that failed because of an error
+func (job ContainerStartJob) errorResult(op string, err error) JobResult {
+	return JobResult{Err: &JobError{Job: job.name, Op: op, Err: err}}
+}
+
+// stopContainer gracefully stops the job container and kills it if it is
+// still running afterwards
+func (job ContainerStartJob) stopContainer(reason error) {
+	logWarningf("%s: Run interrupted (%v). Stopping container.", job.name, reason)
+
+	err := job.client.ContainerStop(job.context, job.containerID, container.StopOptions{})
+	logOnErrWarnf(err, "%s: Could not stop container: %v", job.name, err)
+
+	containerJSON, err := job.client.ContainerInspect(job.context, job.containerID)
+	if err == nil && !containerJSON.State.Running {
+		return
+	}
+
+	err = job.client.ContainerKill(job.context, job.containerID, "SIGKILL")
+	logOnErrWarnf(err, "%s: Could not kill container: %v", job.name, err)
+}
+
+// jobRunner runs a job of any type using the runOnce of that type. Jobs are
+// scheduled on the cron wrapped in one
+type jobRunner struct {
+	job ContainerCronJob
+}
+
+// Run is executed based on the schedule of the job
+func (runner jobRunner) Run() {
+	runner.job.startJob().run(runner.job.runOnce)
+}
+
+// RunNow runs the job immediately, following the same rules as a scheduled
+// run, and returns the result of the final attempt. Output from the run is
+// also written to output
+func (runner jobRunner) RunNow(output io.Writer) JobResult {
+	job := runner.job.startJob()
+	logInfof("%s: Triggered manually", job.name)
+
+	job.output = output
+	job.trigger = triggerManual
+
+	return job.run(runner.job.runOnce)
+}
+
+// RunDependent runs the job because a job it depends on finished
+func (runner jobRunner) RunDependent() {
+	job := runner.job.startJob()
+	job.trigger = triggerDependency
+	job.run(runner.job.runOnce)
+}
+
+// CatchUp runs the job for any runs missed since it last ran according to
+// the catchup policy of the job
+func (runner jobRunner) CatchUp() {
+	runner.job.startJob().catchUp(runner.job.runOnce)
+}
+
+// startJob returns the settings of the job shared by all job types
+func (job ContainerStartJob) startJob() ContainerStartJob {
+	return job
+}
+
+// run enforces the concurrency policy of the job and then calls runOnce
+// until it succeeds or runs out of retries. The result of the final attempt
+// is returned
+func (job ContainerStartJob) run(runOnce func(context.Context) JobResult) JobResult {
+	runCtx, release, ok := jobRuns.acquire(job.UniqueName(), job.concurrency)
+	if !ok {
+		logEvent(levelWarning, jobFields(job, eventSkipped), "%s: Previous run is still in progress. Skipping.", job.name)
+
+		result := JobResult{Skipped: true}
+		observeRun(job, result, time.Now(), time.Now())
+
+		return result
+	}
+	defer release()
+
+	return job.runWithRetries(runCtx, runOnce)
+}
+
+// runWithRetries calls runOnce until it succeeds, is skipped, or the job has
+// no retries remaining. Each attempt is logged separately
+func (job ContainerStartJob) runWithRetries(runCtx context.Context, runOnce func(context.Context) JobResult) JobResult {
+	pinger := job.newRunPinger()
+	runCtx = withRunStarted(runCtx, pinger.start)
+	runCtx = withRunOutput(runCtx, job.output)
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			logInfof("%s: Attempt %d of %d", job.name, attempt, job.retries+1)
+		}
+
+		start := time.Now()
+		attemptCtx, cancel := job.withTimeout(runCtx)
+		result := runOnce(attemptCtx)
+
+		cancel()
+
+		end := time.Now()
+		result.Attempt = attempt
+		job.logResult(result, end.Sub(start))
+		observeRun(job, result, start, end)
+
+		if !result.Failed() || attempt > job.retries {
+			pinger.result(result)
+			job.notify(result, start, end)
+			job.triggerDependents(result)
+
+			return result
+		}
+
+		delay := job.retryDelayFor(attempt)
+		logWarningf("%s: Retrying in %s", job.name, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-runCtx.Done():
+			logWarningf("%s: Run cancelled before retrying", job.name)
+			pinger.result(result)
+			job.notify(result, start, end)
+			job.triggerDependents(result)
+
+			return result
+		}
+	}
+}
+
+// withTimeout returns a context that is done once the job timeout, if any,
+// is exceeded
+func (job ContainerStartJob) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if job.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, job.timeout)
+}
+
+// retryDelayFor returns the delay before retrying after the given attempt
+// using exponential backoff with some added jitter
+func (job ContainerStartJob) retryDelayFor(attempt int) time.Duration {
+	delay, backoff := job.retryDelay, job.retryBackoff
+	if delay == 0 {
+		delay = defaultRetryDelay
+	}
+
+	if backoff == 0 {
+		backoff = defaultRetryBackoff
+	}
+
+	delay = time.Duration(float64(delay) * math.Pow(backoff, float64(attempt-1)))
+	jitter := time.Duration(rand.Float64() * retryJitter * float64(delay))
+
+	return delay + jitter
+}
+
+// logResult logs the outcome of a run
+func (job ContainerStartJob) logResult(result JobResult, duration time.Duration) {
+	fields := jobFields(job, eventFinished)
+	fields["result"] = result.Status()
+	fields["exit_code"] = result.ExitCode
+	fields["duration"] = duration.Seconds()
+	fields["attempt"] = result.Attempt
+	fields["trigger"] = job.triggerSource()
+
+	switch {
+	case result.Err != nil:
+		logEvent(levelError, fields, "%v on attempt %d", result.Err, result.Attempt)
+	case result.Skipped:
+		return
+	case result.Cancelled:
+		logEvent(levelWarning, fields, "%s: Job was replaced by a newer run on attempt %d", job.name, result.Attempt)
+	case result.TimedOut:
+		logEvent(levelError, fields, "%s: Job timed out after %s on attempt %d", job.name, job.timeout, result.Attempt)
+	case result.ExitCode != 0:
+		logEvent(levelError, fields, "%s: Job exited with code %d on attempt %d", job.name, result.ExitCode, result.Attempt)
+	default:
+		logEvent(levelInfo, fields, "%s: Job finished successfully in %s on attempt %d", job.name, duration, result.Attempt)
+	}
+}
+
+// triggerSource returns the source that triggered the run
+func (job ContainerStartJob) triggerSource() string {
+	if job.trigger == "" {
+		return triggerSchedule
+	}
+
+	return job.trigger
+}
+
+// Type returns the type of the job
+func (job ContainerStartJob) Type() string {
+	return "start"
+}
+
 // Name returns the name of the job
 func (job ContainerStartJob) Name() string {
 	return job.name
@@ -120,6 +605,33 @@ func (job ContainerStartJob) Schedule() string {
 	return job.schedule
 }
 
+// ContainerID returns the ID of the container the job runs against
+func (job ContainerStartJob) ContainerID() string {
+	return job.containerID
+}
+
+// Timezone returns the name of the timezone the schedule of the job is in.
+// If empty, the local timezone is used
+func (job ContainerStartJob) Timezone() string {
+	if job.timezone == "" {
+		return defaultTimezone
+	}
+
+	return job.timezone
+}
+
+// CronSchedule parses the schedule of the job in its timezone. Hashed fields
+// and jitter are derived from the unique name of the job so they are stable
+// across restarts
+func (job ContainerStartJob) CronSchedule() (cron.Schedule, error) {
+	schedule, err := parseSchedule(job.schedule, job.Timezone(), job.UniqueName())
+	if err != nil {
+		return nil, err
+	}
+
+	return withJitter(schedule, job.jitter, job.UniqueName()), nil
+}
+
 // UniqueName returns a unique identifier for a container start job
 func (job ContainerStartJob) UniqueName() string {
 	// ContainerID should be unique as a change in label will result in
@@ -131,116 +643,358 @@ func (job ContainerStartJob) UniqueName() string {
 type ContainerExecJob struct {
 	ContainerStartJob
 	shellCommand string
+	// user runs the command as a user other than the container default
+	user    string
+	workdir string
+	// env are additional environment variables in the form NAME=value
+	env []string
+	// shell is the shell and arguments used to run the command. Defaults to
+	// defaultShell
+	shell      []string
+	privileged bool
+	// execCmd is a command run without a shell. If set, it is used instead of
+	// shellCommand
+	execCmd []string
 }
 
-// Run is executed based on the ContainerStartJob Schedule and starts the
-// container
-func (job ContainerExecJob) Run() {
-	slog.Infof("Execing: %s", job.name)
+// Type returns the type of the job
+func (job ContainerExecJob) Type() string {
+	return "exec"
+}
+
+// runOnce execs the command in the container and waits for it to exit,
+// killing it if the run context is done before then
+func (job ContainerExecJob) runOnce(runCtx context.Context) JobResult {
+	logEvent(levelInfo, jobFields(job, eventStarted), "Execing: %s", job.name)
 	containerJSON, err := job.client.ContainerInspect(
 		job.context,
 		job.containerID,
 	)
-	slog.OnErrPanicf(err, "Could not get container details for job %s", job.name)
+	if err != nil {
+		return job.errorResult("get container details", err)
+	}
 
 	if !containerJSON.State.Running {
-		slog.Warningf("%s: Container not running. Skipping exec.", job.name)
+		logEvent(levelWarning, jobFields(job, eventSkipped), "%s: Container not running. Skipping exec.", job.name)
 
-		return
+		return JobResult{Skipped: true}
+	}
+
+	markRunStarted(runCtx)
+
+	execOptions := container.ExecOptions{
+		AttachStdout: true,
+		AttachStderr: true,
+		User:         job.user,
+		WorkingDir:   job.workdir,
+		Privileged:   job.privileged,
+		Env:          job.env,
+		Cmd:          job.cmd(),
+	}
+
+	// Tag the exec processes so they can be found and killed if interrupted
+	runID := ""
+	if job.timeout > 0 || job.concurrency == ConcurrencyReplace {
+		runID = newRunID()
+		execOptions.Env = append(append([]string{}, job.env...), runIDEnv(runID))
 	}
 
 	execID, err := job.client.ContainerExecCreate(
 		job.context,
 		job.containerID,
-		container.ExecOptions{
-			AttachStdout: true,
-			AttachStderr: true,
-			Cmd:          []string{"sh", "-c", strings.TrimSpace(job.shellCommand)},
-		},
+		execOptions,
 	)
-	slog.OnErrPanicf(err, "Could not create container exec job for %s", job.name)
+	if err != nil {
+		return job.errorResult("create exec", err)
+	}
 
 	hj, err := job.client.ContainerExecAttach(job.context, execID.ID, container.ExecAttachOptions{})
-	slog.OnErrWarnf(err, "%s: Error attaching to exec: %s", job.name, err)
+	if err != nil {
+		return job.errorResult("attach to exec", err)
+	}
 	defer hj.Close()
 
-	scanner := bufio.NewScanner(hj.Reader)
-
 	err = job.client.ContainerExecStart(
 		job.context,
 		execID.ID,
 		container.ExecStartOptions{},
 	)
-	slog.OnErrPanicf(err, "Could not start container exec job for %s", job.name)
+	if err != nil {
+		return job.errorResult("start exec", err)
+	}
+
+	// Print output as it is received and keep the tail for the result
+	output := newTailBuffer(historyOutputLimit)
+	outputDone := make(chan bool)
+
+	go job.logOutput(runCtx, hj.Reader, output, outputDone)
 
 	// Wait for job results
 	execInfo := container.ExecInspect{Running: true}
 	for execInfo.Running {
-		time.Sleep(1 * time.Second)
+		if err := runCtx.Err(); err != nil {
+			result := interruptedResult(err)
+
+			// The exec may still be running, eg. if the container has no
+			// shell to kill it with, so it is reported as an error
+			if killErr := job.killExec(execID.ID, runID, err); killErr != nil {
+				result = job.errorResult("kill exec", killErr)
+			}
 
-		slog.Debugf("Still execing %s", job.name)
+			result.Output = output.String()
+
+			return result
+		}
+
+		time.Sleep(pollInterval)
+
+		logDebugf("Still execing %s", job.name)
 		execInfo, err = job.client.ContainerExecInspect(
 			job.context,
 			execID.ID,
 		)
 
-		// Maybe print output
-		if hj.Reader != nil {
-			for scanner.Scan() {
-				line := scanner.Text()
-				if len(line) > 0 {
-					slog.Infof("%s: Exec output: %s", job.name, line)
-				} else {
-					slog.Debugf("%s: Empty exec output", job.name)
-				}
+		logDebugf("%s: Exec info: %+v", job.name, execInfo)
 
-				if err := scanner.Err(); err != nil {
-					slog.OnErrWarnf(err, "%s: Error reading from exec", job.name)
-				}
-			}
-		} else {
-			slog.Debugf("%s: No exec reader", job.name)
+		if err != nil {
+			// Nothing we can do if we got an error here, so let's go
+			return job.errorResult("get exec status", err)
 		}
+	}
+
+	// Make sure all output is logged before reporting results
+	<-outputDone
+
+	logDebugf("%s: Done execing. %+v", job.name, execInfo)
+
+	return JobResult{ExitCode: execInfo.ExitCode, Output: output.String()}
+}
+
+// cmd returns the command to exec, either as given in exec form or run by
+// the shell of the job
+func (job ContainerExecJob) cmd() []string {
+	if len(job.execCmd) > 0 {
+		return append([]string{}, job.execCmd...)
+	}
+
+	shell := job.shell
+	if len(shell) == 0 {
+		shell = defaultShell
+	}
+
+	return append(append([]string{}, shell...), strings.TrimSpace(job.shellCommand))
+}
+
+// logOutput logs each line read from an exec until the stream ends. Lines
+// from stdout are logged as info and from stderr with logStderr. Lines are
+// also written to output
+func (job ContainerExecJob) logOutput(runCtx context.Context, reader *bufio.Reader, output io.Writer, done chan<- bool) {
+	defer close(done)
+
+	if reader == nil {
+		logDebugf("%s: No exec reader", job.name)
+
+		return
+	}
+
+	stdout := job.outputLines(runCtx, output, "Exec output", "stdout", levelInfo)
+	stderr := job.outputLines(runCtx, output, "Exec error output", "stderr", stderrLevel)
+
+	err := copyOutput(stdout, stderr, reader)
+	logOnErrWarnf(err, "%s: Error reading from exec: %v", job.name, err)
+
+	stdout.Flush()
+	stderr.Flush()
+}
+
+// killExec kills all processes in the container that were started by the
+// exec tagged with the given run ID. An error is returned unless the kill
+// script succeeded and the exec has exited, eg. if the container has no shell
+func (job ContainerExecJob) killExec(execID, runID string, reason error) error {
+	logWarningf("%s: Run interrupted (%v). Killing exec.", job.name, reason)
+
+	killID, err := job.client.ContainerExecCreate(
+		job.context,
+		job.containerID,
+		container.ExecOptions{
+			User: job.user,
+			Cmd:  []string{"sh", "-c", execKillScript, "dockron-kill", runIDEnv(runID)},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("could not create kill exec: %w", err)
+	}
+
+	// Errors starting the script, such as a missing shell, are only seen in
+	// its exit code
+	err = job.client.ContainerExecStart(job.context, killID.ID, container.ExecStartOptions{})
+	if err != nil {
+		return fmt.Errorf("could not start kill exec: %w", err)
+	}
+
+	killInfo, err := job.waitExec(killID.ID)
+	if err != nil {
+		return err
+	}
+
+	if killInfo.Running || killInfo.ExitCode != 0 {
+		return fmt.Errorf("%w: kill script exited with code %d", ErrExecNotKilled, killInfo.ExitCode)
+	}
 
-		slog.Debugf("%s: Exec info: %+v", job.name, execInfo)
+	execInfo, err := job.waitExec(execID)
+	if err != nil {
+		return err
+	}
 
+	if execInfo.Running {
+		return fmt.Errorf("%w: exec is still running", ErrExecNotKilled)
+	}
+
+	return nil
+}
+
+// waitExec waits for an exec to exit for up to execKillChecks polls and
+// returns its last status
+func (job ContainerExecJob) waitExec(execID string) (container.ExecInspect, error) {
+	for check := 1; ; check++ {
+		execInfo, err := job.client.ContainerExecInspect(job.context, execID)
 		if err != nil {
-			// Nothing we can do if we got an error here, so let's go
-			slog.OnErrWarnf(err, "%s: Could not get status for exec job", job.name)
+			return execInfo, fmt.Errorf("could not get exec status: %w", err)
+		}
 
-			return
+		if !execInfo.Running || check >= execKillChecks {
+			return execInfo, nil
 		}
+
+		time.Sleep(pollInterval)
 	}
-	slog.Debugf("%s: Done execing. %+v", job.name, execInfo)
-	// Log exit code if failed
-	if execInfo.ExitCode != 0 {
-		slog.Errorf("%s: Exec job existed with code %d", job.name, execInfo.ExitCode)
+}
+
+// runIDEnv returns the environment variable used to tag exec processes
+func runIDEnv(runID string) string {
+	return runIDEnvName + "=" + runID
+}
+
+// observeRun records the result of a single run of a job wherever runs are
+// tracked
+func observeRun(job ContainerStartJob, result JobResult, start, end time.Time) {
+	metrics.ObserveRun(job.name, result, start, end.Sub(start))
+	history.Observe(job, result, start, end)
+}
+
+// interruptedResult returns the result of a run that was interrupted because
+// its context is done
+func interruptedResult(err error) JobResult {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return JobResult{TimedOut: true}
 	}
+
+	return JobResult{Cancelled: true}
 }
 
 // QueryScheduledJobs queries Docker for all containers with a schedule and
-// returns a list of ContainerCronJob records to be scheduled
-func QueryScheduledJobs(client ContainerClient) (jobs []ContainerCronJob) {
-	slog.Debugf("Scanning containers for new schedules...")
+// returns a list of ContainerCronJob records to be scheduled, along with any
+// jobs from the jobs file. The poll is only healthy if both could be read
+func QueryScheduledJobs(client ContainerClient) ([]ContainerCronJob, error) {
+	logDebugf("Scanning containers for new schedules...")
 
-	containers, err := client.ContainerList(
-		context.Background(),
+	jobs, err := queryJobs(
+		client,
 		container.ListOptions{All: true},
+		func(string) bool { return true },
 	)
-	slog.OnErrPanicf(err, "Failure querying docker containers")
+	if err != nil {
+		health.ObservePoll(err)
+
+		return nil, err
+	}
+
+	fileJobs, err := queryFileJobs(client)
+	health.ObservePoll(err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(jobs, fileJobs...), nil
+}
+
+// QueryContainerJobs queries Docker for a single container and returns a
+// list of ContainerCronJob records to be scheduled for it. If the container
+// no longer exists, the list will be empty
+func QueryContainerJobs(client ContainerClient, containerID string) ([]ContainerCronJob, error) {
+	logDebugf("Scanning container %s for new schedules...", containerID)
+
+	jobs, err := queryJobs(
+		client,
+		container.ListOptions{
+			All:     true,
+			Filters: filters.NewArgs(filters.Arg("id", containerID)),
+		},
+		func(id string) bool { return id == containerID },
+	)
+	health.ObservePoll(err)
+
+	return jobs, err
+}
+
+// queryJobs lists containers matching the provided options and builds jobs
+// from their labels. Previously recorded failures for containers matching
+// inScope are replaced by any found in this query
+func queryJobs(
+	client ContainerClient,
+	options container.ListOptions,
+	inScope func(containerID string) bool,
+) ([]ContainerCronJob, error) {
+	containers, err := client.ContainerList(context.Background(), options)
+	if err != nil {
+		return nil, fmt.Errorf("could not list containers: %w", err)
+	}
+
+	health.ClearJobFailures(inScope)
+
+	jobs := []ContainerCronJob{}
 
 	for _, container := range containers {
 		// Add start job
-		if val, ok := container.Labels[schedLabel]; ok {
-			jobName := strings.Join(container.Names, "/")
-
-			jobs = append(jobs, ContainerStartJob{
+		startConfig := startJobConfig(container.Labels)
+		if val, ok := container.Labels[schedLabel]; ok || hasDependencies(startConfig) {
+			job := ContainerStartJob{
 				client:      client,
 				containerID: container.ID,
 				context:     context.Background(),
 				schedule:    val,
-				name:        jobName,
-			})
+				name:        strings.Join(container.Names, "/"),
+			}
+
+			if err := configureJob(&job, startConfig); err != nil {
+				logErrorf("Could not configure job %s: %v", job.name, err)
+				health.ObserveJobFailure(job, err)
+			} else {
+				jobs = appendUniqueJob(jobs, job)
+			}
+		}
+
+		// Add jobs starting and stopping long running containers
+		for _, field := range []string{startScheduleField, stopScheduleField} {
+			if _, ok := startConfig[field]; !ok {
+				continue
+			}
+
+			job, err := newServiceWindowJob(ContainerStartJob{
+				client:      client,
+				containerID: container.ID,
+				context:     context.Background(),
+				name:        strings.Join(container.Names, "/"),
+			}, field, startConfig)
+			if err != nil {
+				logErrorf("Could not configure job %s: %v", job.Name(), err)
+				health.ObserveJobFailure(job, err)
+
+				continue
+			}
+
+			jobs = appendUniqueJob(jobs, job)
 		}
 
 		// Add exec jobs
@@ -266,17 +1020,63 @@ func QueryScheduledJobs(client ContainerClient) (jobs []ContainerCronJob) {
 		}
 
 		for jobName, jobConfig := range execJobs {
+			for field, value := range containerConfig(container.Labels) {
+				if _, ok := jobConfig[field]; !ok {
+					jobConfig[field] = value
+				}
+			}
+
 			schedule, ok := jobConfig["schedule"]
-			if !ok {
+			if !ok && !hasDependencies(jobConfig) {
+				continue
+			}
+
+			// Add run jobs, which create their own containers
+			if _, ok := jobConfig["image"]; ok {
+				job, err := newRunJob(client, container.ID, strings.Join(append(container.Names, jobName), "/"), jobConfig)
+				if err == nil && !isSelf(container.ID) {
+					err = fmt.Errorf("%w: run jobs can only be configured on the dockron container", ErrInvalidLabel)
+				}
+
+				if err != nil {
+					logErrorf("Could not configure job %s: %v", job.name, err)
+					health.ObserveJobFailure(job, err)
+
+					continue
+				}
+
+				jobs = appendUniqueJob(jobs, job)
+
+				continue
+			}
+
+			// Add restart and signal jobs, which act on the container itself
+			if isServiceJob(jobName, jobConfig) {
+				job, err := newServiceJob(ContainerStartJob{
+					client:      client,
+					containerID: container.ID,
+					context:     context.Background(),
+					schedule:    schedule,
+					name:        strings.Join(append(container.Names, jobName), "/"),
+				}, jobConfig)
+				if err != nil {
+					logErrorf("Could not configure job %s: %v", job.Name(), err)
+					health.ObserveJobFailure(job, err)
+
+					continue
+				}
+
+				jobs = appendUniqueJob(jobs, job)
+
 				continue
 			}
 
 			shellCommand, ok := jobConfig["command"]
-			if !ok {
+			if _, hasExec := jobConfig["exec"]; !ok && !hasExec {
 				continue
 			}
 
-			jobs = append(jobs, ContainerExecJob{
+			job := ContainerExecJob{
 				ContainerStartJob: ContainerStartJob{
 					client:      client,
 					containerID: container.ID,
@@ -285,46 +1085,374 @@ func QueryScheduledJobs(client ContainerClient) (jobs []ContainerCronJob) {
 					name:        strings.Join(append(container.Names, jobName), "/"),
 				},
 				shellCommand: shellCommand,
-			})
+			}
+
+			err := configureJob(&job.ContainerStartJob, jobConfig)
+			if err == nil {
+				err = configureExecJob(&job, jobConfig)
+			}
+
+			// Exec output is always logged as it is received
+			if _, ok := jobConfig["logs"]; ok && err == nil {
+				err = fmt.Errorf("%w: logs can only be used with image", ErrInvalidLabel)
+			}
+
+			if err != nil {
+				logErrorf("Could not configure job %s: %v", job.name, err)
+				health.ObserveJobFailure(job, err)
+
+				continue
+			}
+
+			jobs = appendUniqueJob(jobs, job)
+		}
+	}
+
+	return jobs, nil
+}
+
+// appendUniqueJob appends a job to a list of jobs unless it has the same
+// unique name as one already in the list, in which case the clash is reported
+func appendUniqueJob(jobs []ContainerCronJob, job ContainerCronJob) []ContainerCronJob {
+	for _, other := range jobs {
+		if other.UniqueName() == job.UniqueName() {
+			err := fmt.Errorf("%w: %s has the same name as a %s job", ErrInvalidLabel, job.Name(), other.Type())
+			logErrorf("Could not configure job %s: %v", job.Name(), err)
+			health.ObserveJobFailure(job, err)
+
+			return jobs
+		}
+	}
+
+	return append(jobs, job)
+}
+
+// startJobConfig collects the dockron.<field> labels of a container, along
+// with those that apply to all jobs, into a map of fields to values
+func startJobConfig(labels map[string]string) map[string]string {
+	config := containerConfig(labels)
+
+	for label, value := range labels {
+		field, ok := strings.CutPrefix(label, labelPrefix)
+		if ok && !strings.Contains(field, ".") {
+			config[field] = value
+		}
+	}
+
+	return config
+}
+
+// containerConfig collects the labels of a container that apply to all of
+// its jobs into a map of fields to values
+func containerConfig(labels map[string]string) map[string]string {
+	config := map[string]string{}
+
+	for _, field := range containerLabelFields {
+		if value, ok := labels[labelPrefix+field]; ok {
+			config[field] = value
+		}
+	}
+
+	return config
+}
+
+// configureJob applies the optional settings shared by all job types from a
+// map of label fields to values
+func configureJob(job *ContainerStartJob, config map[string]string) (err error) {
+	if val, ok := config["timeout"]; ok {
+		if job.timeout, err = parseDurationLabel("timeout", val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["concurrency"]; ok {
+		if job.concurrency, err = parseConcurrencyPolicy(val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["retries"]; ok {
+		job.retries, err = strconv.Atoi(val)
+		if err != nil || job.retries < 0 {
+			return fmt.Errorf("%w: retries %q must be a non-negative integer", ErrInvalidLabel, val)
+		}
+	}
+
+	if val, ok := config["retry_delay"]; ok {
+		if job.retryDelay, err = parseDurationLabel("retry_delay", val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["logs"]; ok {
+		logs, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("%w: logs %q must be true or false", ErrInvalidLabel, val)
+		}
+
+		job.disableLogs = !logs
+	}
+
+	if val, ok := config["catchup"]; ok {
+		if job.catchup, err = parseCatchupPolicy(val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["catchup_max"]; ok {
+		job.catchupMax, err = strconv.Atoi(val)
+		if err != nil || job.catchupMax < 1 {
+			return fmt.Errorf("%w: catchup_max %q must be a positive integer", ErrInvalidLabel, val)
+		}
+	}
+
+	if val, ok := config["notify.url"]; ok {
+		if job.notifyURL, err = parseWebhookURL("notify.url", val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["notify.on"]; ok {
+		if job.notifyOn, err = parseNotifyPolicy(val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["ping_url"]; ok {
+		if job.pingURL, err = parseWebhookURL("ping_url", val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["retry_backoff"]; ok {
+		job.retryBackoff, err = strconv.ParseFloat(val, 64)
+		if err != nil || job.retryBackoff < 1 {
+			return fmt.Errorf("%w: retry_backoff %q must be a number of at least 1", ErrInvalidLabel, val)
+		}
+	}
+
+	if val, ok := config["timezone"]; ok {
+		if hasTimezonePrefix(job.schedule) {
+			return fmt.Errorf("%w: timezone %q can't be used with a schedule that sets CRON_TZ", ErrInvalidLabel, val)
+		}
+
+		if job.timezone, err = parseTimezone("timezone", val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["jitter"]; ok {
+		if job.jitter, err = parseDurationLabel("jitter", val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["after"]; ok {
+		if job.after, err = parseJobNames("after", val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["on_success"]; ok {
+		if job.onSuccess, err = parseJobNames("on_success", val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["on_failure"]; ok {
+		if job.onFailure, err = parseJobNames("on_failure", val); err != nil {
+			return err
+		}
+	}
+
+	// Jobs triggered by other jobs may not have a schedule
+	if job.schedule == "" {
+		return nil
+	}
+
+	// Check the schedule now so it is reported along with other labels
+	if _, err := job.CronSchedule(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// configureExecJob applies the optional settings of exec jobs from a map of
+// label fields to values
+func configureExecJob(job *ContainerExecJob, config map[string]string) error {
+	job.user = config["user"]
+	job.workdir = config["workdir"]
+
+	if val, ok := config["exec"]; ok {
+		if _, ok := config["command"]; ok {
+			return fmt.Errorf("%w: only one of command or exec can be set", ErrInvalidLabel)
+		}
+
+		if _, ok := config["shell"]; ok {
+			return fmt.Errorf("%w: shell can't be used with exec as it runs without a shell", ErrInvalidLabel)
+		}
+
+		if err := json.Unmarshal([]byte(val), &job.execCmd); err != nil || len(job.execCmd) == 0 || job.execCmd[0] == "" {
+			return fmt.Errorf(
+				"%w: exec %q must be a JSON array of strings, eg. [\"/app/job\", \"--flag\"]",
+				ErrInvalidLabel,
+				val,
+			)
+		}
+	}
+
+	if val, ok := config["shell"]; ok {
+		job.shell = strings.Fields(val)
+		if len(job.shell) == 0 {
+			return fmt.Errorf("%w: shell must not be empty", ErrInvalidLabel)
+		}
+	}
+
+	if val, ok := config["privileged"]; ok {
+		privileged, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("%w: privileged %q must be true or false", ErrInvalidLabel, val)
+		}
+
+		job.privileged = privileged
+	}
+
+	for _, field := range sortedKeys(config) {
+		if name, ok := strings.CutPrefix(field, "env."); ok {
+			job.env = append(job.env, name+"="+config[field])
 		}
 	}
 
-	return jobs
+	return nil
+}
+
+// parseDurationLabel parses the value of a label holding a non-negative
+// duration
+func parseDurationLabel(field, val string) (time.Duration, error) {
+	duration, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s %q: %w", ErrInvalidLabel, field, val, err)
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("%w: %s %q must not be negative", ErrInvalidLabel, field, val)
+	}
+
+	return duration, nil
+}
+
+// RunJobNow queries Docker for a job by name or unique name and runs it
+// immediately, writing any output to the provided writer
+func RunJobNow(client ContainerClient, name string, output io.Writer) (JobResult, error) {
+	jobs, err := QueryScheduledJobs(client)
+	if err != nil {
+		return JobResult{}, err
+	}
+
+	for _, job := range jobs {
+		if jobMatches(job, name) {
+			return jobRunner{job}.RunNow(output), nil
+		}
+	}
+
+	return JobResult{}, fmt.Errorf("%w: %s", ErrJobNotFound, name)
 }
 
 // ScheduleJobs accepts a Cron instance and a list of jobs to schedule.
 // It then schedules the provided jobs
 func ScheduleJobs(c *cron.Cron, jobs []ContainerCronJob) {
+	scheduleJobs(c, jobs, func(ContainerCronJob) bool { return true })
+}
+
+// ScheduleContainerJobs accepts a Cron instance, a container ID and the list
+// of jobs for that container. It schedules the provided jobs and unschedules
+// any that no longer exist without touching jobs for other containers
+func ScheduleContainerJobs(c *cron.Cron, containerID string, jobs []ContainerCronJob) {
+	scheduleJobs(c, jobs, func(job ContainerCronJob) bool {
+		return job.ContainerID() == containerID
+	})
+}
+
+// scheduleJobs schedules the provided jobs and removes any existing jobs
+// matching inScope that are not in the provided list
+func scheduleJobs(c *cron.Cron, jobs []ContainerCronJob, inScope func(ContainerCronJob) bool) {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+
 	// Fetch existing jobs from the cron
 	existingJobs := map[string]cron.EntryID{}
+	foundJobs := map[string]bool{}
+
 	for _, entry := range c.Entries() {
-		// This should be safe since ContainerCronJob is the only type of job we use
-		existingJobs[entry.Job.(ContainerCronJob).UniqueName()] = entry.ID
+		job := entryJob(entry)
+		if inScope(job) {
+			existingJobs[job.UniqueName()] = entry.ID
+		}
 	}
 
+	cyclic := jobGraph.update(jobs, inScope)
+
 	for _, job := range jobs {
+		foundJobs[job.UniqueName()] = true
+
+		if cyclic[job.UniqueName()] {
+			err := fmt.Errorf("%w: %s would trigger itself", ErrDependencyCycle, job.Name())
+			health.ObserveJobFailure(job, err)
+			logErrorf("Could not schedule %s (%s): %v", job.Name(), job.UniqueName(), err)
+
+			continue
+		}
+
+		// Paused jobs stay off the cron until resumed
+		if pausedJobs.refresh(job) {
+			logDebugf("Job %s is paused. Skipping", job.Name())
+
+			continue
+		}
+
 		if _, ok := existingJobs[job.UniqueName()]; ok {
 			// Job already exists, remove it from existing jobs so we don't
 			// unschedule it later
-			slog.Debugf("Job %s is already scheduled. Skipping", job.Name())
+			logDebugf("Job %s is already scheduled. Skipping", job.Name())
 			delete(existingJobs, job.UniqueName())
 
 			continue
 		}
 
+		// Jobs without a schedule only run when triggered by other jobs
+		if job.Schedule() == "" {
+			logDebugf("Job %s has no schedule. Waiting for jobs it depends on", job.Name())
+
+			continue
+		}
+
 		// Job doesn't exist yet, schedule it
-		_, err := c.AddJob(job.Schedule(), job)
+		_, err := addJob(c, job)
 		if err == nil {
-			slog.Infof(
-				"Scheduled %s (%s) with schedule '%s'\n",
+			fields := jobFields(job, eventScheduled)
+			fields["schedule"] = job.Schedule()
+			fields["schedule_format"] = scheduleFormat()
+			fields["type"] = job.Type()
+
+			if job.Timezone() != "" {
+				fields["timezone"] = job.Timezone()
+			}
+
+			logEvent(
+				levelInfo,
+				fields,
+				"Scheduled %s (%s) with schedule '%s'",
 				job.Name(),
 				job.UniqueName(),
 				job.Schedule(),
 			)
+
+			jobRunner{job}.CatchUp()
 		} else {
-			// TODO: Track something for a healthcheck here
-			slog.Errorf(
-				"Could not schedule %s (%s) with schedule '%s'. %v\n",
+			health.ObserveJobFailure(job, err)
+			logErrorf(
+				"Could not schedule %s (%s) with schedule '%s'. %v",
 				job.Name(),
 				job.UniqueName(),
 				job.Schedule(),
@@ -337,6 +1465,132 @@ func ScheduleJobs(c *cron.Cron, jobs []ContainerCronJob) {
 	for _, entryID := range existingJobs {
 		c.Remove(entryID)
 	}
+
+	// Forget paused jobs that no longer exist
+	pausedJobs.forget(func(job ContainerCronJob) bool {
+		return inScope(job) && !foundJobs[job.UniqueName()]
+	})
+
+	metrics.ObserveSchedule(c)
+}
+
+// RescheduleContainer updates the scheduled jobs for a single container
+func RescheduleContainer(client ContainerClient, c *cron.Cron, containerID string) error {
+	jobs, err := QueryContainerJobs(client, containerID)
+	if err != nil {
+		return err
+	}
+
+	ScheduleContainerJobs(c, containerID, jobs)
+
+	return nil
+}
+
+// Resync updates the scheduled jobs for all containers
+func Resync(client ContainerClient, c *cron.Cron) error {
+	jobs, err := QueryScheduledJobs(client)
+	if err != nil {
+		return err
+	}
+
+	ScheduleJobs(c, jobs)
+
+	return nil
+}
+
+// containerEventFilters returns the filters used to subscribe to Docker
+// events that may change scheduled jobs
+func containerEventFilters() filters.Args {
+	args := filters.NewArgs(filters.Arg("type", string(events.ContainerEventType)))
+	for _, action := range watchedEvents {
+		args.Add("event", string(action))
+	}
+
+	return args
+}
+
+// WatchDocker schedules all jobs and then subscribes to Docker events to
+// reschedule containers as they change. A full resync is performed every
+// watchInterval as a safety net for any missed events. If Docker can't be
+// reached, the resync is retried with backoff. It returns once the context
+// is done
+func WatchDocker(ctx context.Context, client ContainerClient, c *cron.Cron, watchInterval time.Duration) {
+	var (
+		messages <-chan events.Message
+		errs     <-chan error
+		retry    <-chan time.Time
+	)
+
+	retryDelay := minDockerRetryDelay
+
+	resync := func() {
+		if err := Resync(client, c); err != nil {
+			logErrorf("Could not query Docker for jobs. Retrying in %s: %v", retryDelay, err)
+
+			retry = time.After(retryDelay)
+			retryDelay = min(2*retryDelay, watchInterval)
+
+			return
+		}
+
+		retry = nil
+		retryDelay = minDockerRetryDelay
+
+		// Subscribe if there is no stream yet or the previous one was lost
+		if messages == nil {
+			messages, errs = client.Events(ctx, events.ListOptions{Filters: containerEventFilters()})
+		}
+	}
+
+	resync()
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Periodically resync everything in case an event was missed
+			resync()
+		case <-retry:
+			resync()
+		case msg := <-messages:
+			logDebugf("Received %s event for container %s", msg.Action, msg.Actor.ID)
+
+			if err := RescheduleContainer(client, c, msg.Actor.ID); err != nil {
+				logErrorf("Could not reschedule container %s: %v", msg.Actor.ID, err)
+			}
+		case err := <-errs:
+			if ctx.Err() != nil {
+				return
+			}
+
+			// The event stream is closed after an error. Disable it until the
+			// next successful resync so a down daemon doesn't cause a busy loop
+			logWarningf("Lost Docker event stream. Will resubscribe on next resync: %v", err)
+
+			messages, errs = nil, nil
+
+			if retry == nil {
+				resync()
+			}
+		}
+	}
+}
+
+// cronLogger logs messages from cron using slog
+type cronLogger struct{}
+
+// Info logs routine messages from cron as debug messages
+func (cronLogger) Info(msg string, keysAndValues ...interface{}) {
+	logDebugf("cron: %s %v", msg, keysAndValues)
+}
+
+// Error logs errors from cron, including recovered panics
+func (cronLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	logErrorf("cron: %s: %v %v", msg, err, keysAndValues)
 }
 
 func main() {
@@ -348,9 +1602,43 @@ func main() {
 	var watchInterval time.Duration
 
 	showVersion := flag.Bool("version", false, "Display the version of dockron and exit")
+	metricsAddr := flag.String("metrics-addr", "", "Address to serve Prometheus metrics on, eg. :9090. Disabled if empty")
+	httpAddr := flag.String("http-addr", "", "Address to serve the HTTP API and health checks on, eg. :8080. Disabled if empty")
+	stateDir := flag.String("state-dir", "", "Directory to persist run history in. History is kept in memory if empty")
+	historyMaxRuns := flag.Int("history-max-runs", defaultHistoryMaxRuns, "Number of runs to keep in the history of each job")
+	historyMaxAge := flag.Duration("history-max-age", 0, "Maximum age of runs to keep in the history, eg. 720h. Unlimited if 0")
+	flag.StringVar(
+		&apiToken,
+		"api-token",
+		os.Getenv("DOCKRON_API_TOKEN"),
+		"Token required to act on jobs over the HTTP API, also read from DOCKRON_API_TOKEN. Unauthenticated if empty",
+	)
+	flag.StringVar(&notifyWebhook, "notify-webhook", "", "URL to notify about runs of jobs without a dockron.notify.url label. Disabled if empty")
+	flag.BoolVar(&cronSeconds, "cron-seconds", false, "Allow schedules to start with an optional seconds field")
+	flag.StringVar(&jobsFile, "jobs-file", "", "JSON file of run jobs to schedule in addition to those from labels. Disabled if empty")
+	selfContainerFlag := flag.String(
+		"container-id",
+		"",
+		"ID or name of the container dockron runs in, used to read run jobs from its labels. Found by hostname if empty",
+	)
+	flag.StringVar(&defaultTimezone, "timezone", "", "Timezone of schedules without a dockron.timezone label, eg. America/New_York. Defaults to local time")
+	logFormatFlag := flag.String("log-format", logFormatText, "Format to write logs in. One of text or json")
+	stderrLevelFlag := flag.String("stderr-level", levelWarning, "Level to log output to stderr from jobs at. One of debug, info, warning or error")
+	unhealthyAfter := flag.Int(
+		"unhealthy-after",
+		defaultUnhealthyAfter,
+		"Number of consecutive failed Docker polls before reporting unhealthy",
+	)
 
-	flag.DurationVar(&watchInterval, "watch", defaultWatchInterval, "Interval used to poll Docker for changes")
+	flag.DurationVar(&watchInterval, "watch", defaultWatchInterval, "Interval used to fully resync with Docker in addition to watching events")
 	flag.BoolVar(&slog.DebugLevel, "debug", false, "Show debug logs")
+	flag.Usage = func() {
+		fmt.Fprintln(
+			flag.CommandLine.Output(),
+			"Usage: dockron [flags] [run <job-name> | pause <job-name> [duration] | resume <job-name>]",
+		)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	// Print version if asked
@@ -359,17 +1647,56 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Create a Cron
-	c := cron.New()
-	c.Start()
+	logFormat, err = parseLogFormat(*logFormatFlag)
+	slog.OnErrPanicf(err, "Invalid -log-format")
 
-	// Start the loop
-	for {
-		// Schedule jobs again
-		jobs := QueryScheduledJobs(client)
-		ScheduleJobs(c, jobs)
+	stderrLevel, err = parseLogLevel(*stderrLevelFlag)
+	slog.OnErrPanicf(err, "Invalid -stderr-level")
 
-		// Sleep until the next query time
-		time.Sleep(watchInterval)
+	if defaultTimezone != "" {
+		_, err = parseTimezone("-timezone", defaultTimezone)
+		slog.OnErrPanicf(err, "Invalid -timezone")
 	}
+
+	if notifyWebhook != "" {
+		_, err = parseWebhookURL("-notify-webhook", notifyWebhook)
+		slog.OnErrPanicf(err, "Invalid -notify-webhook")
+	}
+
+	history = NewHistory(*historyMaxRuns, *historyMaxAge)
+
+	hostname, _ := os.Hostname()
+	selfContainerID = resolveSelfContainer(instrumentedClient{client}, *selfContainerFlag, hostname)
+
+	// Run a subcommand if asked, now that logging is set up. The history in
+	// the state dir belongs to the running dockron, so it is not opened
+	switch flag.Arg(0) {
+	case "run":
+		os.Exit(runCommand(instrumentedClient{client}, *httpAddr, flag.Args()[1:]))
+	case "pause":
+		os.Exit(pauseCommand(*httpAddr, flag.Args()[1:]))
+	case "resume":
+		os.Exit(resumeCommand(*httpAddr, flag.Args()[1:]))
+	}
+
+	if *stateDir != "" {
+		history, err = OpenHistory(*stateDir, *historyMaxRuns, *historyMaxAge)
+		slog.OnErrPanicf(err, "Could not open run history")
+	}
+
+	logInfof("Parsing schedules in %s format in %s timezone", scheduleFormat(), time.Local)
+
+	if defaultTimezone != "" {
+		logInfof("Using %s timezone for schedules without a timezone label", defaultTimezone)
+	}
+
+	// Create a Cron that recovers from panics in jobs
+	c := cron.New(cron.WithChain(cron.Recover(cronLogger{})))
+	c.Start()
+
+	health.SetUnhealthyAfter(*unhealthyAfter)
+	StartHTTPServers(*httpAddr, *metricsAddr, NewAPI(c))
+
+	// Watch Docker for changes until we're killed
+	WatchDocker(context.Background(), instrumentedClient{client}, c, watchInterval)
 }
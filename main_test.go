@@ -4,14 +4,22 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	dockerTypes "github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/robfig/cron/v3"
 	"golang.org/x/net/context"
 )
@@ -87,6 +95,24 @@ func (fakeClient *FakeDockerClient) ContainerStart(context context.Context, cont
 	return
 }
 
+func (fakeClient *FakeDockerClient) ContainerStop(ctx context.Context, containerID string, options container.StopOptions) (e error) {
+	results := fakeClient.called("ContainerStop", ctx, containerID, options)
+	if results[0] != nil {
+		e = results[0].(error)
+	}
+
+	return
+}
+
+func (fakeClient *FakeDockerClient) ContainerKill(ctx context.Context, containerID, signal string) (e error) {
+	results := fakeClient.called("ContainerKill", ctx, containerID, signal)
+	if results[0] != nil {
+		e = results[0].(error)
+	}
+
+	return
+}
+
 func (fakeClient *FakeDockerClient) ContainerList(context context.Context, options container.ListOptions) (c []dockerTypes.Container, e error) {
 	results := fakeClient.called("ContainerList", context, options)
 	if results[0] != nil {
@@ -148,12 +174,130 @@ func (fakeClient *FakeDockerClient) ContainerInspect(ctx context.Context, contai
 	return
 }
 
-func (fakeClient *FakeDockerClient) ContainerExecAttach(ctx context.Context, execID string, options container.ExecAttachOptions) (dockerTypes.HijackedResponse, error) {
+func (fakeClient *FakeDockerClient) ContainerCreate(
+	ctx context.Context,
+	config *container.Config,
+	hostConfig *container.HostConfig,
+	networkingConfig *network.NetworkingConfig,
+	platform *ocispec.Platform,
+	containerName string,
+) (r container.CreateResponse, e error) {
+	results := fakeClient.called("ContainerCreate", ctx, config, hostConfig, networkingConfig, platform, containerName)
+	if results[0] != nil {
+		r = results[0].(container.CreateResponse)
+	}
+
+	if results[1] != nil {
+		e = results[1].(error)
+	}
+
+	return
+}
+
+func (fakeClient *FakeDockerClient) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) (e error) {
+	results := fakeClient.called("ContainerRemove", ctx, containerID, options)
+	if results[0] != nil {
+		e = results[0].(error)
+	}
+
+	return
+}
+
+func (fakeClient *FakeDockerClient) ContainerRestart(ctx context.Context, containerID string, options container.StopOptions) (e error) {
+	results := fakeClient.called("ContainerRestart", ctx, containerID, options)
+	if results[0] != nil {
+		e = results[0].(error)
+	}
+
+	return
+}
+
+func (fakeClient *FakeDockerClient) ImagePull(ctx context.Context, refStr string, options image.PullOptions) (r io.ReadCloser, e error) {
+	results := fakeClient.called("ImagePull", ctx, refStr, options)
+	if results[0] != nil {
+		r = results[0].(io.ReadCloser)
+	}
+
+	if results[1] != nil {
+		e = results[1].(error)
+	}
+
+	return
+}
+
+// ContainerExecAttach returns some fixed output unless results are provided,
+// in which case the call is recorded like any other
+func (fakeClient *FakeDockerClient) ContainerExecAttach(ctx context.Context, execID string, options container.ExecAttachOptions) (r dockerTypes.HijackedResponse, e error) {
+	if len(fakeClient.FakeResults["ContainerExecAttach"]) > 0 {
+		results := fakeClient.called("ContainerExecAttach", ctx, execID, options)
+		if results[0] != nil {
+			r = results[0].(dockerTypes.HijackedResponse)
+		}
+
+		if results[1] != nil {
+			e = results[1].(error)
+		}
+
+		return
+	}
+
+	conn, _ := net.Pipe()
+
 	return dockerTypes.HijackedResponse{
+		Conn:   conn,
 		Reader: bufio.NewReader(strings.NewReader("Some output from our command")),
 	}, nil
 }
 
+// ContainerLogs returns no output unless results are provided, in which case
+// the call is recorded like any other
+func (fakeClient *FakeDockerClient) ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (r io.ReadCloser, e error) {
+	if len(fakeClient.FakeResults["ContainerLogs"]) > 0 {
+		results := fakeClient.called("ContainerLogs", ctx, containerID, options)
+		if results[0] != nil {
+			r = results[0].(io.ReadCloser)
+		}
+
+		if results[1] != nil {
+			e = results[1].(error)
+		}
+
+		return
+	}
+
+	return io.NopCloser(strings.NewReader("")), nil
+}
+
+// Events emits the scripted list of messages followed by an optional error
+func (fakeClient *FakeDockerClient) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	results := fakeClient.called("Events", ctx, options)
+	messages := make(chan events.Message)
+	errs := make(chan error, 1)
+
+	var fakeMessages []events.Message
+	if results[0] != nil {
+		fakeMessages = results[0].([]events.Message)
+	}
+
+	go func() {
+		for _, msg := range fakeMessages {
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+
+				return
+			}
+		}
+
+		if results[1] != nil {
+			errs <- results[1].(error)
+		}
+	}()
+
+	return messages, errs
+}
+
 // NewFakeDockerClient creates an empty client
 func NewFakeDockerClient() *FakeDockerClient {
 	return &FakeDockerClient{
@@ -165,11 +309,23 @@ func NewFakeDockerClient() *FakeDockerClient {
 func ErrorUnequal(t *testing.T, expected interface{}, actual interface{}, message string) {
 	t.Helper()
 
-	if expected != actual {
+	if !reflect.DeepEqual(expected, actual) {
 		t.Errorf("%s Expected: %+v Actual: %+v", message, expected, actual)
 	}
 }
 
+// useFastPolling shortens the poll interval of jobs for the duration of a test
+func useFastPolling(t *testing.T) {
+	t.Helper()
+
+	interval := pollInterval
+	pollInterval = time.Millisecond
+
+	t.Cleanup(func() {
+		pollInterval = interval
+	})
+}
+
 // TestQueryScheduledJobs checks that when querying the Docker client that we
 // create jobs for any containers with a dockron.schedule
 func TestQueryScheduledJobs(t *testing.T) {
@@ -293,126 +449,857 @@ func TestQueryScheduledJobs(t *testing.T) {
 			},
 		},
 		{
-			name: "Dual exec jobs on single container",
+			name: "Container with timeout",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"has_schedule_1"},
+					ID:    "has_schedule_1",
+					Labels: map[string]string{
+						"dockron.schedule": "* * * * *",
+						"dockron.timeout":  "10m",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerStartJob{
+					name:        "has_schedule_1",
+					containerID: "has_schedule_1",
+					schedule:    "* * * * *",
+					context:     context.Background(),
+					client:      client,
+					timeout:     10 * time.Minute,
+				},
+			},
+		},
+		{
+			name: "Container with invalid timeout",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"has_schedule_1"},
+					ID:    "has_schedule_1",
+					Labels: map[string]string{
+						"dockron.schedule": "* * * * *",
+						"dockron.timeout":  "ten minutes",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Exec job with timeout",
 			fakeContainers: []dockerTypes.Container{
 				{
 					Names: []string{"exec_job_1"},
 					ID:    "exec_job_1",
 					Labels: map[string]string{
-						"dockron.test1.schedule": "* * * * *",
-						"dockron.test1.command":  "date",
-						"dockron.test2.schedule": "* * * * *",
-						"dockron.test2.command":  "date",
+						"dockron.test.schedule": "* * * * *",
+						"dockron.test.command":  "date",
+						"dockron.test.timeout":  "30s",
 					},
 				},
 			},
 			expectedJobs: []ContainerCronJob{
 				ContainerExecJob{
 					ContainerStartJob: ContainerStartJob{
-						name:        "exec_job_1/test1",
+						name:        "exec_job_1/test",
 						containerID: "exec_job_1",
 						schedule:    "* * * * *",
 						context:     context.Background(),
 						client:      client,
+						timeout:     30 * time.Second,
 					},
 					shellCommand: "date",
 				},
+			},
+		},
+		{
+			name: "Exec job with retries",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test.schedule":      "* * * * *",
+						"dockron.test.command":       "date",
+						"dockron.test.retries":       "3",
+						"dockron.test.retry_delay":   "5s",
+						"dockron.test.retry_backoff": "1.5",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
 				ContainerExecJob{
 					ContainerStartJob: ContainerStartJob{
-						name:        "exec_job_1/test2",
+						name:         "exec_job_1/test",
+						containerID:  "exec_job_1",
+						schedule:     "* * * * *",
+						context:      context.Background(),
+						client:       client,
+						retries:      3,
+						retryDelay:   5 * time.Second,
+						retryBackoff: 1.5,
+					},
+					shellCommand: "date",
+				},
+			},
+		},
+		{
+			name: "Container with invalid retries",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"has_schedule_1"},
+					ID:    "has_schedule_1",
+					Labels: map[string]string{
+						"dockron.schedule": "* * * * *",
+						"dockron.retries":  "-1",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Exec job with concurrency policy",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test.schedule":    "* * * * *",
+						"dockron.test.command":     "date",
+						"dockron.test.concurrency": "queue",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerExecJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "exec_job_1/test",
 						containerID: "exec_job_1",
 						schedule:    "* * * * *",
 						context:     context.Background(),
 						client:      client,
+						concurrency: ConcurrencyQueue,
 					},
 					shellCommand: "date",
 				},
 			},
 		},
-	}
-
-	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			log.Printf("Running %s", t.Name())
-
-			// Load fake containers
-			t.Logf("Fake containers: %+v", c.fakeContainers)
-			client.FakeResults["ContainerList"] = []FakeResult{
-				{c.fakeContainers, nil},
-			}
-
-			jobs := QueryScheduledJobs(client)
-			// Sort so we can compare each list of jobs
-			sort.Slice(jobs, func(i, j int) bool {
-				return jobs[i].UniqueName() < jobs[j].UniqueName()
-			})
-
-			t.Logf("Expected jobs: %+v, Actual jobs: %+v", c.expectedJobs, jobs)
-			ErrorUnequal(t, len(c.expectedJobs), len(jobs), "Job lengths don't match")
-
-			for i, job := range jobs {
-				ErrorUnequal(t, c.expectedJobs[i], job, "Job value does not match")
-			}
-		})
-	}
-}
-
-// TestScheduleJobs validates that only new jobs get created
-func TestScheduleJobs(t *testing.T) {
-	croner := cron.New()
-
-	// Each cases is on the same cron instance
-	// Tests must be executed sequentially!
-	cases := []struct {
-		name         string
-		queriedJobs  []ContainerCronJob
-		expectedJobs []ContainerCronJob
-	}{
 		{
-			name:         "No containers",
-			queriedJobs:  []ContainerCronJob{},
+			name: "Exec job with invalid concurrency policy",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test.schedule":    "* * * * *",
+						"dockron.test.command":     "date",
+						"dockron.test.concurrency": "sometimes",
+					},
+				},
+			},
 			expectedJobs: []ContainerCronJob{},
 		},
 		{
-			name: "One container with schedule",
-			queriedJobs: []ContainerCronJob{
-				ContainerStartJob{
-					name:        "has_schedule_1",
-					containerID: "has_schedule_1",
-					schedule:    "* * * * *",
+			name: "Exec job with catchup policy",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test.schedule":    "* * * * *",
+						"dockron.test.command":     "date",
+						"dockron.test.catchup":     "all",
+						"dockron.test.catchup_max": "3",
+					},
 				},
 			},
 			expectedJobs: []ContainerCronJob{
-				ContainerStartJob{
-					name:        "has_schedule_1",
-					containerID: "has_schedule_1",
-					schedule:    "* * * * *",
+				ContainerExecJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "exec_job_1/test",
+						containerID: "exec_job_1",
+						schedule:    "* * * * *",
+						context:     context.Background(),
+						client:      client,
+						catchup:     CatchupAll,
+						catchupMax:  3,
+					},
+					shellCommand: "date",
 				},
 			},
 		},
 		{
-			name: "Add a second job",
-			queriedJobs: []ContainerCronJob{
-				ContainerStartJob{
-					name:        "has_schedule_1",
-					containerID: "has_schedule_1",
-					schedule:    "* * * * *",
-				},
-				ContainerStartJob{
-					name:        "has_schedule_2",
-					containerID: "has_schedule_2",
-					schedule:    "* * * * *",
+			name: "Start job with logs disabled",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"start_job"},
+					ID:    "start_job",
+					Labels: map[string]string{
+						"dockron.schedule": "* * * * *",
+						"dockron.logs":     "false",
+					},
 				},
 			},
 			expectedJobs: []ContainerCronJob{
 				ContainerStartJob{
-					name:        "has_schedule_1",
-					containerID: "has_schedule_1",
-					schedule:    "* * * * *",
-				},
-				ContainerStartJob{
-					name:        "has_schedule_2",
-					containerID: "has_schedule_2",
+					name:        "start_job",
+					containerID: "start_job",
+					schedule:    "* * * * *",
+					context:     context.Background(),
+					client:      client,
+					disableLogs: true,
+				},
+			},
+		},
+		{
+			name: "Start job with invalid catchup policy",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"start_job"},
+					ID:    "start_job",
+					Labels: map[string]string{
+						"dockron.schedule": "* * * * *",
+						"dockron.catchup":  "always",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Container with notify labels",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"notify_job"},
+					ID:    "notify_job",
+					Labels: map[string]string{
+						"dockron.schedule":      "* * * * *",
+						"dockron.notify.url":    "http://hooks.example.com/dockron",
+						"dockron.notify.on":     "always",
+						"dockron.test.schedule": "* * * * *",
+						"dockron.test.command":  "date",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerStartJob{
+					name:        "notify_job",
+					containerID: "notify_job",
+					schedule:    "* * * * *",
+					context:     context.Background(),
+					client:      client,
+					notifyURL:   "http://hooks.example.com/dockron",
+					notifyOn:    NotifyAlways,
+				},
+				ContainerExecJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "notify_job/test",
+						containerID: "notify_job",
+						schedule:    "* * * * *",
+						context:     context.Background(),
+						client:      client,
+						notifyURL:   "http://hooks.example.com/dockron",
+						notifyOn:    NotifyAlways,
+					},
+					shellCommand: "date",
+				},
+			},
+		},
+		{
+			name: "Exec job with ping URL",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test.schedule": "* * * * *",
+						"dockron.test.command":  "date",
+						"dockron.test.ping_url": "https://hc-ping.com/abc",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerExecJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "exec_job_1/test",
+						containerID: "exec_job_1",
+						schedule:    "* * * * *",
+						context:     context.Background(),
+						client:      client,
+						pingURL:     "https://hc-ping.com/abc",
+					},
+					shellCommand: "date",
+				},
+			},
+		},
+		{
+			name: "Jobs with timezones",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"tz_job"},
+					ID:    "tz_job",
+					Labels: map[string]string{
+						"dockron.schedule":      "0 9 * * *",
+						"dockron.timezone":      "UTC",
+						"dockron.test.schedule": "0 9 * * *",
+						"dockron.test.command":  "date",
+						"dockron.test.timezone": "Etc/GMT+5",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerExecJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "tz_job/test",
+						containerID: "tz_job",
+						schedule:    "0 9 * * *",
+						context:     context.Background(),
+						client:      client,
+						timezone:    "Etc/GMT+5",
+					},
+					shellCommand: "date",
+				},
+				ContainerStartJob{
+					name:        "tz_job",
+					containerID: "tz_job",
+					schedule:    "0 9 * * *",
+					context:     context.Background(),
+					client:      client,
+					timezone:    "UTC",
+				},
+			},
+		},
+		{
+			name: "Start job with jitter and hashed schedule",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"start_job"},
+					ID:    "start_job",
+					Labels: map[string]string{
+						"dockron.schedule": "H H(0-5) * * *",
+						"dockron.jitter":   "5m",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerStartJob{
+					name:        "start_job",
+					containerID: "start_job",
+					schedule:    "H H(0-5) * * *",
+					context:     context.Background(),
+					client:      client,
+					jitter:      5 * time.Minute,
+				},
+			},
+		},
+		{
+			name: "Jobs triggered by other jobs",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"transform"},
+					ID:    "transform",
+					Labels: map[string]string{
+						"dockron.after":            "extract",
+						"dockron.alert.command":    "date",
+						"dockron.alert.on_failure": "extract, transform",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerExecJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "transform/alert",
+						containerID: "transform",
+						context:     context.Background(),
+						client:      client,
+						onFailure:   "extract, transform",
+					},
+					shellCommand: "date",
+				},
+				ContainerStartJob{
+					name:        "transform",
+					containerID: "transform",
+					context:     context.Background(),
+					client:      client,
+					after:       "extract",
+				},
+			},
+		},
+		{
+			name: "Start job with empty dependency",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"start_job"},
+					ID:    "start_job",
+					Labels: map[string]string{
+						"dockron.on_success": "extract,",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Exec job with options",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test.schedule":     "* * * * *",
+						"dockron.test.command":      "echo $GREETING",
+						"dockron.test.user":         "1000:1000",
+						"dockron.test.workdir":      "/app",
+						"dockron.test.env.NAME":     "dockron",
+						"dockron.test.env.GREETING": "hello",
+						"dockron.test.shell":        "/bin/bash -c",
+						"dockron.test.privileged":   "true",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerExecJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "exec_job_1/test",
+						containerID: "exec_job_1",
+						schedule:    "* * * * *",
+						context:     context.Background(),
+						client:      client,
+					},
+					shellCommand: "echo $GREETING",
+					user:         "1000:1000",
+					workdir:      "/app",
+					env:          []string{"GREETING=hello", "NAME=dockron"},
+					shell:        []string{"/bin/bash", "-c"},
+					privileged:   true,
+				},
+			},
+		},
+		{
+			name: "Exec job in exec form",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test.schedule": "* * * * *",
+						"dockron.test.exec":     `["/app/job", "--name", "two words"]`,
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerExecJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "exec_job_1/test",
+						containerID: "exec_job_1",
+						schedule:    "* * * * *",
+						context:     context.Background(),
+						client:      client,
+					},
+					execCmd: []string{"/app/job", "--name", "two words"},
+				},
+			},
+		},
+		{
+			name: "Exec job with command and exec",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test.schedule": "* * * * *",
+						"dockron.test.command":  "date",
+						"dockron.test.exec":     `["date"]`,
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Exec job with invalid exec",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test.schedule": "* * * * *",
+						"dockron.test.exec":     "/app/job --flag",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Restart and signal jobs",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"service"},
+					ID:    "service",
+					Labels: map[string]string{
+						"dockron.restart.schedule":   "0 4 * * *",
+						"dockron.logrotate.schedule": "0 0 * * *",
+						"dockron.logrotate.signal":   "hup",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerSignalJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "service/logrotate",
+						containerID: "service",
+						schedule:    "0 0 * * *",
+						context:     context.Background(),
+						client:      client,
+					},
+					signal: "SIGHUP",
+				},
+				ContainerRestartJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "service/restart",
+						containerID: "service",
+						schedule:    "0 4 * * *",
+						context:     context.Background(),
+						client:      client,
+					},
+				},
+			},
+		},
+		{
+			name: "Service start and stop schedules",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"service"},
+					ID:    "service",
+					Labels: map[string]string{
+						"dockron.start_schedule": "0 9 * * 1-5",
+						"dockron.stop_schedule":  "0 17 * * 1-5",
+						"dockron.stop_timeout":   "1m",
+						"dockron.timezone":       "Europe/Paris",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerStartServiceJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "service/start_schedule",
+						containerID: "service",
+						schedule:    "0 9 * * 1-5",
+						timezone:    "Europe/Paris",
+						context:     context.Background(),
+						client:      client,
+					},
+				},
+				ContainerStopServiceJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "service/stop_schedule",
+						containerID: "service",
+						schedule:    "0 17 * * 1-5",
+						timezone:    "Europe/Paris",
+						context:     context.Background(),
+						client:      client,
+					},
+					stopTimeout: time.Minute,
+				},
+			},
+		},
+		{
+			name: "Service schedule with exec job of the same name",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"service"},
+					ID:    "service",
+					Labels: map[string]string{
+						"dockron.start_schedule":          "0 9 * * 1-5",
+						"dockron.start_schedule.schedule": "* * * * *",
+						"dockron.start_schedule.command":  "date",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerStartServiceJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "service/start_schedule",
+						containerID: "service",
+						schedule:    "0 9 * * 1-5",
+						context:     context.Background(),
+						client:      client,
+					},
+				},
+			},
+		},
+		{
+			name: "Service schedules with schedule",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"service"},
+					ID:    "service",
+					Labels: map[string]string{
+						"dockron.schedule":       "* * * * *",
+						"dockron.start_schedule": "0 9 * * 1-5",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerStartJob{
+					name:        "service",
+					containerID: "service",
+					schedule:    "* * * * *",
+					context:     context.Background(),
+					client:      client,
+				},
+			},
+		},
+		{
+			name: "Service stop schedule with invalid stop timeout",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"service"},
+					ID:    "service",
+					Labels: map[string]string{
+						"dockron.stop_schedule": "0 17 * * 1-5",
+						"dockron.stop_timeout":  "soon",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Signal job with invalid signal",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"service"},
+					ID:    "service",
+					Labels: map[string]string{
+						"dockron.logrotate.schedule": "0 0 * * *",
+						"dockron.logrotate.signal":   "SIG HUP",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Signal job with command",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"service"},
+					ID:    "service",
+					Labels: map[string]string{
+						"dockron.logrotate.schedule": "0 0 * * *",
+						"dockron.logrotate.signal":   "SIGHUP",
+						"dockron.logrotate.command":  "date",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Exec job with logs",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test.schedule": "* * * * *",
+						"dockron.test.command":  "date",
+						"dockron.test.logs":     "false",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Exec job with invalid privileged",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test.schedule":   "* * * * *",
+						"dockron.test.command":    "date",
+						"dockron.test.privileged": "sometimes",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Start job with invalid timezone",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"start_job"},
+					ID:    "start_job",
+					Labels: map[string]string{
+						"dockron.schedule": "* * * * *",
+						"dockron.timezone": "Mars/Olympus_Mons",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Start job with timezone and CRON_TZ",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"start_job"},
+					ID:    "start_job",
+					Labels: map[string]string{
+						"dockron.schedule": "CRON_TZ=UTC * * * * *",
+						"dockron.timezone": "UTC",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Start job with invalid schedule",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"start_job"},
+					ID:    "start_job",
+					Labels: map[string]string{
+						"dockron.schedule": "0 0 * * * *",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Start job with invalid notify URL",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"start_job"},
+					ID:    "start_job",
+					Labels: map[string]string{
+						"dockron.schedule":   "* * * * *",
+						"dockron.notify.url": "hooks.example.com",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "Dual exec jobs on single container",
+			fakeContainers: []dockerTypes.Container{
+				{
+					Names: []string{"exec_job_1"},
+					ID:    "exec_job_1",
+					Labels: map[string]string{
+						"dockron.test1.schedule": "* * * * *",
+						"dockron.test1.command":  "date",
+						"dockron.test2.schedule": "* * * * *",
+						"dockron.test2.command":  "date",
+					},
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerExecJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "exec_job_1/test1",
+						containerID: "exec_job_1",
+						schedule:    "* * * * *",
+						context:     context.Background(),
+						client:      client,
+					},
+					shellCommand: "date",
+				},
+				ContainerExecJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "exec_job_1/test2",
+						containerID: "exec_job_1",
+						schedule:    "* * * * *",
+						context:     context.Background(),
+						client:      client,
+					},
+					shellCommand: "date",
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			log.Printf("Running %s", t.Name())
+
+			// Load fake containers
+			t.Logf("Fake containers: %+v", c.fakeContainers)
+			client.FakeResults["ContainerList"] = []FakeResult{
+				{c.fakeContainers, nil},
+			}
+
+			jobs, err := QueryScheduledJobs(client)
+			if err != nil {
+				t.Fatalf("Unexpected error querying jobs: %v", err)
+			}
+
+			// Sort so we can compare each list of jobs
+			sort.Slice(jobs, func(i, j int) bool {
+				return jobs[i].UniqueName() < jobs[j].UniqueName()
+			})
+
+			t.Logf("Expected jobs: %+v, Actual jobs: %+v", c.expectedJobs, jobs)
+			ErrorUnequal(t, len(c.expectedJobs), len(jobs), "Job lengths don't match")
+
+			for i, job := range jobs {
+				ErrorUnequal(t, c.expectedJobs[i], job, "Job value does not match")
+			}
+		})
+	}
+}
+
+// TestScheduleJobs validates that only new jobs get created
+func TestScheduleJobs(t *testing.T) {
+	croner := cron.New()
+
+	// Each cases is on the same cron instance
+	// Tests must be executed sequentially!
+	cases := []struct {
+		name         string
+		queriedJobs  []ContainerCronJob
+		expectedJobs []ContainerCronJob
+	}{
+		{
+			name:         "No containers",
+			queriedJobs:  []ContainerCronJob{},
+			expectedJobs: []ContainerCronJob{},
+		},
+		{
+			name: "One container with schedule",
+			queriedJobs: []ContainerCronJob{
+				ContainerStartJob{
+					name:        "has_schedule_1",
+					containerID: "has_schedule_1",
+					schedule:    "* * * * *",
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerStartJob{
+					name:        "has_schedule_1",
+					containerID: "has_schedule_1",
+					schedule:    "* * * * *",
+				},
+			},
+		},
+		{
+			name: "Add a second job",
+			queriedJobs: []ContainerCronJob{
+				ContainerStartJob{
+					name:        "has_schedule_1",
+					containerID: "has_schedule_1",
+					schedule:    "* * * * *",
+				},
+				ContainerStartJob{
+					name:        "has_schedule_2",
+					containerID: "has_schedule_2",
+					schedule:    "* * * * *",
+				},
+			},
+			expectedJobs: []ContainerCronJob{
+				ContainerStartJob{
+					name:        "has_schedule_1",
+					containerID: "has_schedule_1",
+					schedule:    "* * * * *",
+				},
+				ContainerStartJob{
+					name:        "has_schedule_2",
+					containerID: "has_schedule_2",
 					schedule:    "* * * * *",
 				},
 			},
@@ -460,7 +1347,7 @@ func TestScheduleJobs(t *testing.T) {
 			ErrorUnequal(t, len(c.expectedJobs), len(scheduledEntries), "Job and entry lengths don't match")
 
 			for i, entry := range scheduledEntries {
-				ErrorUnequal(t, c.expectedJobs[i], entry.Job, "Job value does not match entry")
+				ErrorUnequal(t, c.expectedJobs[i], entryJob(entry), "Job value does not match entry")
 			}
 		})
 	}
@@ -656,8 +1543,9 @@ func TestDoLoop(t *testing.T) {
 			}
 
 			// Execute loop iteration loop
-			jobs := QueryScheduledJobs(client)
-			ScheduleJobs(croner, jobs)
+			if err := Resync(client, croner); err != nil {
+				t.Fatalf("Unexpected error querying jobs: %v", err)
+			}
 
 			// Validate results
 
@@ -667,7 +1555,7 @@ func TestDoLoop(t *testing.T) {
 			ErrorUnequal(t, len(c.expectedJobs), len(scheduledEntries), "Job and entry lengths don't match")
 
 			for i, entry := range scheduledEntries {
-				ErrorUnequal(t, c.expectedJobs[i], entry.Job, "Job value does not match entry")
+				ErrorUnequal(t, c.expectedJobs[i], entryJob(entry), "Job value does not match entry")
 			}
 		})
 	}
@@ -688,13 +1576,14 @@ func TestRunExecJobs(t *testing.T) {
 	jobCommand := "true"
 
 	cases := []struct {
-		name          string
-		client        *FakeDockerClient
-		expectPanic   bool
-		expectedCalls map[string][]FakeCall
+		name           string
+		client         *FakeDockerClient
+		expectedStatus string
+		expectedCalls  map[string][]FakeCall
 	}{
 		{
-			name: "Initial inspect call raises error",
+			name:           "Initial inspect call raises error",
+			expectedStatus: resultError,
 			client: &FakeDockerClient{
 				FakeResults: map[string][]FakeResult{
 					"ContainerInspect": {
@@ -707,10 +1596,10 @@ func TestRunExecJobs(t *testing.T) {
 					FakeCall{jobContext, jobContainerID},
 				},
 			},
-			expectPanic: true,
 		},
 		{
-			name: "Handle container not running",
+			name:           "Handle container not running",
+			expectedStatus: resultSkipped,
 			client: &FakeDockerClient{
 				FakeResults: map[string][]FakeResult{
 					"ContainerInspect": {
@@ -725,13 +1614,47 @@ func TestRunExecJobs(t *testing.T) {
 			},
 		},
 		{
-			name: "Handle error creating exec",
+			name:           "Handle error creating exec",
+			expectedStatus: resultError,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerInspect": {
+						{runningContainerInfo, nil},
+					},
+					"ContainerExecCreate": {
+						{nil, errGeneric},
+					},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerInspect": {
+					{jobContext, jobContainerID},
+				},
+				"ContainerExecCreate": {
+					{
+						jobContext,
+						jobContainerID,
+						container.ExecOptions{
+							AttachStdout: true,
+							AttachStderr: true,
+							Cmd:          []string{"sh", "-c", jobCommand},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:           "Handle error attaching to exec",
+			expectedStatus: resultError,
 			client: &FakeDockerClient{
 				FakeResults: map[string][]FakeResult{
 					"ContainerInspect": {
 						{runningContainerInfo, nil},
 					},
 					"ContainerExecCreate": {
+						{dockerTypes.IDResponse{ID: "id"}, nil},
+					},
+					"ContainerExecAttach": {
 						{nil, errGeneric},
 					},
 				},
@@ -751,11 +1674,14 @@ func TestRunExecJobs(t *testing.T) {
 						},
 					},
 				},
+				"ContainerExecAttach": {
+					{jobContext, "id", container.ExecAttachOptions{}},
+				},
 			},
-			expectPanic: true,
 		},
 		{
-			name: "Fail starting exec container",
+			name:           "Fail starting exec container",
+			expectedStatus: resultError,
 			client: &FakeDockerClient{
 				FakeResults: map[string][]FakeResult{
 					"ContainerInspect": {
@@ -788,10 +1714,10 @@ func TestRunExecJobs(t *testing.T) {
 					{jobContext, "id", container.ExecStartOptions{}},
 				},
 			},
-			expectPanic: true,
 		},
 		{
-			name: "Successfully start an exec job fail on status",
+			name:           "Successfully start an exec job fail on status",
+			expectedStatus: resultError,
 			client: &FakeDockerClient{
 				FakeResults: map[string][]FakeResult{
 					"ContainerInspect": {
@@ -832,7 +1758,8 @@ func TestRunExecJobs(t *testing.T) {
 			},
 		},
 		{
-			name: "Successfully start an exec job and run to completion",
+			name:           "Successfully start an exec job and run to completion",
+			expectedStatus: resultSuccess,
 			client: &FakeDockerClient{
 				FakeResults: map[string][]FakeResult{
 					"ContainerInspect": {
@@ -878,33 +1805,112 @@ func TestRunExecJobs(t *testing.T) {
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			log.Printf("Running %s", t.Name())
+			log.Printf("Running %s", t.Name())
+
+			// Create test job
+			job := ContainerExecJob{
+				ContainerStartJob: ContainerStartJob{
+					name:        "test_job",
+					context:     jobContext,
+					client:      c.client,
+					containerID: jobContainerID,
+				},
+				shellCommand: jobCommand,
+			}
+
+			result := job.runOnce(context.Background())
+
+			ErrorUnequal(t, c.expectedStatus, result.Status(), "Unexpected result")
+			c.client.AssertFakeCalls(t, c.expectedCalls, "Failed")
+		})
+	}
+}
+
+// TestExecJobOptions checks that exec job options are passed to Docker
+func TestExecJobOptions(t *testing.T) {
+	defer func(newID func() string) {
+		newRunID = newID
+	}(newRunID)
+
+	newRunID = func() string { return "run" }
+
+	cases := []struct {
+		name            string
+		timeout         time.Duration
+		execCmd         []string
+		expectedOptions container.ExecOptions
+	}{
+		{
+			name: "Options",
+			expectedOptions: container.ExecOptions{
+				AttachStdout: true,
+				AttachStderr: true,
+				User:         "nobody",
+				WorkingDir:   "/data",
+				Privileged:   true,
+				Env:          []string{"A=1", "B=2"},
+				Cmd:          []string{"/bin/bash", "-lc", "echo $A"},
+			},
+		},
+		{
+			name:    "Options with timeout",
+			timeout: time.Minute,
+			expectedOptions: container.ExecOptions{
+				AttachStdout: true,
+				AttachStderr: true,
+				User:         "nobody",
+				WorkingDir:   "/data",
+				Privileged:   true,
+				Env:          []string{"A=1", "B=2", runIDEnv("run")},
+				Cmd:          []string{"/bin/bash", "-lc", "echo $A"},
+			},
+		},
+		{
+			name:    "Exec form",
+			execCmd: []string{"/app/job", "--flag"},
+			expectedOptions: container.ExecOptions{
+				AttachStdout: true,
+				AttachStderr: true,
+				User:         "nobody",
+				WorkingDir:   "/data",
+				Privileged:   true,
+				Env:          []string{"A=1", "B=2"},
+				Cmd:          []string{"/app/job", "--flag"},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := NewFakeDockerClient()
+			client.FakeResults["ContainerInspect"] = []FakeResult{
+				{runningContainerInfo, nil},
+			}
+			client.FakeResults["ContainerExecCreate"] = []FakeResult{
+				{nil, errGeneric},
+			}
 
-			// Create test job
 			job := ContainerExecJob{
 				ContainerStartJob: ContainerStartJob{
 					name:        "test_job",
-					context:     jobContext,
-					client:      c.client,
-					containerID: jobContainerID,
-				},
-				shellCommand: jobCommand,
+					context:     context.Background(),
+					client:      client,
+					containerID: "container_id",
+					timeout:     c.timeout,
+				},
+				shellCommand: "echo $A",
+				user:         "nobody",
+				workdir:      "/data",
+				env:          []string{"A=1", "B=2"},
+				shell:        []string{"/bin/bash", "-lc"},
+				privileged:   true,
+				execCmd:      c.execCmd,
 			}
 
-			defer func() {
-				// Recover from panics, if there were any
-				if err := recover(); err != nil {
-					t.Log("Recovered from panic")
-					t.Log(err)
-				}
-
-				c.client.AssertFakeCalls(t, c.expectedCalls, "Failed")
-			}()
-			job.Run()
+			job.runOnce(context.Background())
 
-			if c.expectPanic {
-				t.Errorf("Expected panic but got none")
-			}
+			ErrorUnequal(t, c.expectedOptions, client.FakeCalls["ContainerExecCreate"][0][2], "Unexpected exec options")
+			ErrorUnequal(t, []string{"A=1", "B=2"}, job.env, "Expected job environment not to change")
 		})
 	}
 }
@@ -920,13 +1926,14 @@ func TestRunStartJobs(t *testing.T) {
 	jobContainerID := "container_id"
 
 	cases := []struct {
-		name          string
-		client        *FakeDockerClient
-		expectPanic   bool
-		expectedCalls map[string][]FakeCall
+		name           string
+		client         *FakeDockerClient
+		expectedStatus string
+		expectedCalls  map[string][]FakeCall
 	}{
 		{
-			name: "Initial inspect call raises error",
+			name:           "Initial inspect call raises error",
+			expectedStatus: resultError,
 			client: &FakeDockerClient{
 				FakeResults: map[string][]FakeResult{
 					"ContainerInspect": {
@@ -939,10 +1946,10 @@ func TestRunStartJobs(t *testing.T) {
 					{jobContext, jobContainerID},
 				},
 			},
-			expectPanic: true,
 		},
 		{
-			name: "Handle container already running",
+			name:           "Handle container already running",
+			expectedStatus: resultSkipped,
 			client: &FakeDockerClient{
 				FakeResults: map[string][]FakeResult{
 					"ContainerInspect": {
@@ -957,7 +1964,8 @@ func TestRunStartJobs(t *testing.T) {
 			},
 		},
 		{
-			name: "Handle error starting container",
+			name:           "Handle error starting container",
+			expectedStatus: resultError,
 			client: &FakeDockerClient{
 				FakeResults: map[string][]FakeResult{
 					"ContainerInspect": {
@@ -976,7 +1984,30 @@ func TestRunStartJobs(t *testing.T) {
 			},
 		},
 		{
-			name: "Successfully start a container",
+			name:           "Handle error checking on running container",
+			expectedStatus: resultError,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerInspect": {
+						{stoppedContainerInfo, nil},
+						{nil, errGeneric},
+					},
+					"ContainerStart": {{nil}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerInspect": {
+					{jobContext, jobContainerID},
+					{jobContext, jobContainerID},
+				},
+				"ContainerStart": {
+					{jobContext, jobContainerID, container.StartOptions{}},
+				},
+			},
+		},
+		{
+			name:           "Successfully start a container",
+			expectedStatus: resultSuccess,
 			client: &FakeDockerClient{
 				FakeResults: map[string][]FakeResult{
 					"ContainerInspect": {
@@ -1012,17 +2043,684 @@ func TestRunStartJobs(t *testing.T) {
 				containerID: jobContainerID,
 			}
 
-			defer func() {
-				// Recover from panics, if there were any
-				_ = recover()
+			result := job.runOnce(context.Background())
+
+			ErrorUnequal(t, c.expectedStatus, result.Status(), "Unexpected result")
+			c.client.AssertFakeCalls(t, c.expectedCalls, "Failed")
+		})
+	}
+}
+
+// sortedUniqueNames returns the sorted unique names of all cron entries
+func sortedUniqueNames(c *cron.Cron) []string {
+	names := []string{}
+	for _, entry := range c.Entries() {
+		names = append(names, entryJob(entry).UniqueName())
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// TestScheduleContainerJobs validates that only jobs for the given container
+// are added or removed
+func TestScheduleContainerJobs(t *testing.T) {
+	croner := cron.New()
+
+	ScheduleJobs(croner, []ContainerCronJob{
+		ContainerStartJob{name: "job_1", containerID: "container_1", schedule: "* * * * *"},
+		ContainerStartJob{name: "job_2", containerID: "container_2", schedule: "* * * * *"},
+	})
+
+	// Rename the job on container 1 and add a new one
+	ScheduleContainerJobs(croner, "container_1", []ContainerCronJob{
+		ContainerStartJob{name: "job_1_renamed", containerID: "container_1", schedule: "* * * * *"},
+	})
+
+	expected := []string{"job_1_renamed/container_1", "job_2/container_2"}
+	if actual := sortedUniqueNames(croner); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected jobs %v but got %v", expected, actual)
+	}
+
+	// Remove all jobs for container 2
+	ScheduleContainerJobs(croner, "container_2", []ContainerCronJob{})
+
+	expected = []string{"job_1_renamed/container_1"}
+	if actual := sortedUniqueNames(croner); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected jobs %v but got %v", expected, actual)
+	}
+}
+
+// TestWatchDocker checks that scripted Docker events reschedule only the
+// containers they refer to
+func TestWatchDocker(t *testing.T) {
+	croner := cron.New()
+	client := NewFakeDockerClient()
+
+	client.FakeResults["ContainerList"] = []FakeResult{
+		// Initial full sync
+		{[]dockerTypes.Container{
+			{
+				Names:  []string{"has_schedule_1"},
+				ID:     "has_schedule_1",
+				Labels: map[string]string{"dockron.schedule": "* * * * *"},
+			},
+			{
+				Names:  []string{"has_schedule_2"},
+				ID:     "has_schedule_2",
+				Labels: map[string]string{"dockron.schedule": "* * * * *"},
+			},
+		}, nil},
+		// Create event for container 3
+		{[]dockerTypes.Container{
+			{
+				Names:  []string{"has_schedule_3"},
+				ID:     "has_schedule_3",
+				Labels: map[string]string{"dockron.schedule": "* * * * *"},
+			},
+		}, nil},
+		// Destroy event for container 1
+		{[]dockerTypes.Container{}, nil},
+		// Rename event for container 2
+		{[]dockerTypes.Container{
+			{
+				Names:  []string{"renamed_2"},
+				ID:     "has_schedule_2",
+				Labels: map[string]string{"dockron.schedule": "* * * * *"},
+			},
+		}, nil},
+	}
+	client.FakeResults["Events"] = []FakeResult{
+		{[]events.Message{
+			{Type: events.ContainerEventType, Action: events.ActionCreate, Actor: events.Actor{ID: "has_schedule_3"}},
+			{Type: events.ContainerEventType, Action: events.ActionDestroy, Actor: events.Actor{ID: "has_schedule_1"}},
+			{Type: events.ContainerEventType, Action: events.ActionRename, Actor: events.Actor{ID: "has_schedule_2"}},
+		}, nil},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+
+	go func() {
+		WatchDocker(ctx, client, croner, time.Hour)
+		done <- true
+	}()
+
+	expected := []string{"has_schedule_3/has_schedule_3", "renamed_2/has_schedule_2"}
+
+	// Wait for all events to be processed
+	deadline := time.Now().Add(5 * time.Second)
+	for !reflect.DeepEqual(expected, sortedUniqueNames(croner)) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	if actual := sortedUniqueNames(croner); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected jobs %v but got %v", expected, actual)
+	}
+
+	idFilter := func(id string) container.ListOptions {
+		return container.ListOptions{All: true, Filters: filters.NewArgs(filters.Arg("id", id))}
+	}
+
+	client.AssertFakeCalls(t, map[string][]FakeCall{
+		"ContainerList": {
+			{context.Background(), container.ListOptions{All: true}},
+			{context.Background(), idFilter("has_schedule_3")},
+			{context.Background(), idFilter("has_schedule_1")},
+			{context.Background(), idFilter("has_schedule_2")},
+		},
+		"Events": {
+			{ctx, events.ListOptions{Filters: containerEventFilters()}},
+		},
+	}, "Unexpected Docker calls")
+}
+
+// TestRunJobTimeouts checks that jobs exceeding their timeout are stopped and
+// reported as timed out
+func TestRunJobTimeouts(t *testing.T) {
+	var jobContext context.Context
+
+	jobContainerID := "container_id"
+	jobCommand := "sleep 100"
+
+	useFastPolling(t)
+
+	defer func(runID func() string) {
+		newRunID = runID
+	}(newRunID)
+
+	newRunID = func() string { return "run_id" }
+
+	expiredCtx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	t.Run("Start job stopped gracefully", func(t *testing.T) {
+		client := &FakeDockerClient{
+			FakeResults: map[string][]FakeResult{
+				"ContainerInspect": {
+					{stoppedContainerInfo, nil},
+					{stoppedContainerInfo, nil},
+				},
+				"ContainerStart": {{nil}},
+				"ContainerStop":  {{nil}},
+			},
+		}
+
+		job := ContainerStartJob{
+			name:        "test_job",
+			context:     jobContext,
+			client:      client,
+			containerID: jobContainerID,
+			timeout:     time.Nanosecond,
+		}
+
+		result := job.runOnce(expiredCtx)
+		ErrorUnequal(t, JobResult{TimedOut: true}, result, "Unexpected result")
+
+		client.AssertFakeCalls(t, map[string][]FakeCall{
+			"ContainerInspect": {
+				{jobContext, jobContainerID},
+				{jobContext, jobContainerID},
+			},
+			"ContainerStart": {
+				{jobContext, jobContainerID, container.StartOptions{}},
+			},
+			"ContainerStop": {
+				{jobContext, jobContainerID, container.StopOptions{}},
+			},
+		}, "Failed")
+	})
+
+	t.Run("Start job killed when stop fails", func(t *testing.T) {
+		client := &FakeDockerClient{
+			FakeResults: map[string][]FakeResult{
+				"ContainerInspect": {
+					{stoppedContainerInfo, nil},
+					{runningContainerInfo, nil},
+				},
+				"ContainerStart": {{nil}},
+				"ContainerStop":  {{errGeneric}},
+				"ContainerKill":  {{nil}},
+			},
+		}
+
+		job := ContainerStartJob{
+			name:        "test_job",
+			context:     jobContext,
+			client:      client,
+			containerID: jobContainerID,
+			timeout:     time.Nanosecond,
+		}
+
+		result := job.runOnce(expiredCtx)
+		ErrorUnequal(t, JobResult{TimedOut: true}, result, "Unexpected result")
+
+		client.AssertFakeCalls(t, map[string][]FakeCall{
+			"ContainerInspect": {
+				{jobContext, jobContainerID},
+				{jobContext, jobContainerID},
+			},
+			"ContainerStart": {
+				{jobContext, jobContainerID, container.StartOptions{}},
+			},
+			"ContainerStop": {
+				{jobContext, jobContainerID, container.StopOptions{}},
+			},
+			"ContainerKill": {
+				{jobContext, jobContainerID, "SIGKILL"},
+			},
+		}, "Failed")
+	})
+
+	t.Run("Exec job killed", func(t *testing.T) {
+		client := &FakeDockerClient{
+			FakeResults: map[string][]FakeResult{
+				"ContainerInspect": {
+					{runningContainerInfo, nil},
+				},
+				"ContainerExecCreate": {
+					{dockerTypes.IDResponse{ID: "id"}, nil},
+					{dockerTypes.IDResponse{ID: "kill_id"}, nil},
+				},
+				"ContainerExecStart": {
+					{nil},
+					{nil},
+				},
+				"ContainerExecInspect": {
+					{container.ExecInspect{}, nil},
+					{container.ExecInspect{ExitCode: 137}, nil},
+				},
+			},
+		}
+
+		job := ContainerExecJob{
+			ContainerStartJob: ContainerStartJob{
+				name:        "test_job",
+				context:     jobContext,
+				client:      client,
+				containerID: jobContainerID,
+				timeout:     time.Nanosecond,
+			},
+			shellCommand: jobCommand,
+		}
+
+		result := job.runOnce(expiredCtx)
+		ErrorUnequal(t, JobResult{TimedOut: true}, result, "Unexpected result")
+
+		client.AssertFakeCalls(t, map[string][]FakeCall{
+			"ContainerInspect": {
+				{jobContext, jobContainerID},
+			},
+			"ContainerExecCreate": {
+				{
+					jobContext,
+					jobContainerID,
+					container.ExecOptions{
+						AttachStdout: true,
+						AttachStderr: true,
+						Cmd:          []string{"sh", "-c", jobCommand},
+						Env:          []string{"DOCKRON_RUN_ID=run_id"},
+					},
+				},
+				{
+					jobContext,
+					jobContainerID,
+					container.ExecOptions{
+						Cmd: []string{"sh", "-c", execKillScript, "dockron-kill", "DOCKRON_RUN_ID=run_id"},
+					},
+				},
+			},
+			"ContainerExecStart": {
+				{jobContext, "id", container.ExecStartOptions{}},
+				{jobContext, "kill_id", container.ExecStartOptions{}},
+			},
+			"ContainerExecInspect": {
+				{jobContext, "kill_id"},
+				{jobContext, "id"},
+			},
+		}, "Failed")
+	})
+
+	t.Run("Exec job could not be killed", func(t *testing.T) {
+		defer func(checks int) {
+			execKillChecks = checks
+		}(execKillChecks)
+
+		execKillChecks = 2
+
+		stillRunning := container.ExecInspect{Running: true}
+
+		cases := []struct {
+			name           string
+			startResult    FakeResult
+			inspectResults []FakeResult
+			inspectCalls   []FakeCall
+			notKilled      bool
+		}{
+			{
+				name:        "Kill exec not started",
+				startResult: FakeResult{errGeneric},
+			},
+			{
+				name:           "No shell in container",
+				startResult:    FakeResult{nil},
+				inspectResults: []FakeResult{{container.ExecInspect{ExitCode: 127}, nil}},
+				inspectCalls:   []FakeCall{{jobContext, "kill_id"}},
+				notKilled:      true,
+			},
+			{
+				name:        "Exec still running",
+				startResult: FakeResult{nil},
+				inspectResults: []FakeResult{
+					{container.ExecInspect{}, nil},
+					{stillRunning, nil},
+					{stillRunning, nil},
+				},
+				inspectCalls: []FakeCall{{jobContext, "kill_id"}, {jobContext, "id"}, {jobContext, "id"}},
+				notKilled:    true,
+			},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				client := &FakeDockerClient{
+					FakeResults: map[string][]FakeResult{
+						"ContainerInspect": {
+							{runningContainerInfo, nil},
+						},
+						"ContainerExecCreate": {
+							{dockerTypes.IDResponse{ID: "id"}, nil},
+							{dockerTypes.IDResponse{ID: "kill_id"}, nil},
+						},
+						"ContainerExecStart":   {{nil}, c.startResult},
+						"ContainerExecInspect": c.inspectResults,
+					},
+				}
+
+				job := ContainerExecJob{
+					ContainerStartJob: ContainerStartJob{
+						name:        "test_job",
+						context:     jobContext,
+						client:      client,
+						containerID: jobContainerID,
+						timeout:     time.Nanosecond,
+					},
+					execCmd: []string{"/job"},
+				}
+
+				result := job.runOnce(expiredCtx)
+				ErrorUnequal(t, resultError, result.Status(), "Unexpected result")
+
+				ErrorUnequal(t, c.notKilled, errors.Is(result.Err, ErrExecNotKilled), "Unexpected error "+fmt.Sprint(result.Err))
+
+				expectedCalls := map[string][]FakeCall{
+					"ContainerInspect": {
+						{jobContext, jobContainerID},
+					},
+					"ContainerExecCreate": {
+						{
+							jobContext,
+							jobContainerID,
+							container.ExecOptions{
+								AttachStdout: true,
+								AttachStderr: true,
+								Cmd:          []string{"/job"},
+								Env:          []string{"DOCKRON_RUN_ID=run_id"},
+							},
+						},
+						{
+							jobContext,
+							jobContainerID,
+							container.ExecOptions{
+								Cmd: []string{"sh", "-c", execKillScript, "dockron-kill", "DOCKRON_RUN_ID=run_id"},
+							},
+						},
+					},
+					"ContainerExecStart": {
+						{jobContext, "id", container.ExecStartOptions{}},
+						{jobContext, "kill_id", container.ExecStartOptions{}},
+					},
+				}
+				if c.inspectCalls != nil {
+					expectedCalls["ContainerExecInspect"] = c.inspectCalls
+				}
+
+				client.AssertFakeCalls(t, expectedCalls, "Failed")
+			})
+		}
+	})
+}
+
+// TestRunJobRetries checks that failed jobs are retried until they succeed
+// or run out of retries
+func TestRunJobRetries(t *testing.T) {
+	var jobContext context.Context
+
+	jobContainerID := "container_id"
+
+	useFastPolling(t)
+
+	failedContainerInfo := dockerTypes.ContainerJSON{
+		ContainerJSONBase: &dockerTypes.ContainerJSONBase{
+			State: &dockerTypes.ContainerState{
+				Running:  false,
+				ExitCode: 1,
+			},
+		},
+	}
+
+	cases := []struct {
+		name          string
+		retries       int
+		fakeResults   map[string][]FakeResult
+		expectedStart int
+	}{
+		{
+			name:    "Succeeds after a retry",
+			retries: 2,
+			fakeResults: map[string][]FakeResult{
+				"ContainerInspect": {
+					{stoppedContainerInfo, nil},
+					{failedContainerInfo, nil},
+					{stoppedContainerInfo, nil},
+					{stoppedContainerInfo, nil},
+				},
+				"ContainerStart": {{nil}, {nil}},
+			},
+			expectedStart: 2,
+		},
+		{
+			name:    "Fails on all attempts",
+			retries: 1,
+			fakeResults: map[string][]FakeResult{
+				"ContainerInspect": {
+					{stoppedContainerInfo, nil},
+					{failedContainerInfo, nil},
+					{failedContainerInfo, nil},
+					{failedContainerInfo, nil},
+				},
+				"ContainerStart": {{nil}, {nil}},
+			},
+			expectedStart: 2,
+		},
+		{
+			name:    "Skipped runs are not retried",
+			retries: 2,
+			fakeResults: map[string][]FakeResult{
+				"ContainerInspect": {
+					{runningContainerInfo, nil},
+				},
+			},
+			expectedStart: 0,
+		},
+	}
 
-				c.client.AssertFakeCalls(t, c.expectedCalls, "Failed")
-			}()
-			job.Run()
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := &FakeDockerClient{FakeResults: c.fakeResults}
 
-			if c.expectPanic {
-				t.Errorf("Expected panic but got none")
+			job := ContainerStartJob{
+				name:         "test_job",
+				context:      jobContext,
+				client:       client,
+				containerID:  jobContainerID,
+				retries:      c.retries,
+				retryDelay:   time.Millisecond,
+				retryBackoff: 1,
 			}
+			jobRunner{job}.Run()
+
+			ErrorUnequal(t, c.expectedStart, len(client.FakeCalls["ContainerStart"]), "Unexpected number of attempts")
 		})
 	}
 }
+
+// TestRetryDelay checks that retry delays back off exponentially
+func TestRetryDelay(t *testing.T) {
+	job := ContainerStartJob{retryDelay: time.Second, retryBackoff: 2}
+
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		delay := job.retryDelayFor(attempt + 1)
+		maxDelay := time.Duration(float64(expected) * (1 + retryJitter))
+
+		if delay < expected || delay > maxDelay {
+			t.Errorf("Expected delay for attempt %d between %s and %s but got %s", attempt+1, expected, maxDelay, delay)
+		}
+	}
+}
+
+// TestQueryScheduledJobsError checks that errors listing containers are
+// returned rather than panicking
+func TestQueryScheduledJobsError(t *testing.T) {
+	client := NewFakeDockerClient()
+	client.FakeResults["ContainerList"] = []FakeResult{
+		{nil, errGeneric},
+	}
+
+	jobs, err := QueryScheduledJobs(client)
+	if !errors.Is(err, errGeneric) {
+		t.Errorf("Expected error listing containers but got %v", err)
+	}
+
+	ErrorUnequal(t, 0, len(jobs), "Expected no jobs")
+}
+
+// TestJobErrors checks that Docker errors during a run are returned as
+// structured errors and retried like other failures
+func TestJobErrors(t *testing.T) {
+	useFastPolling(t)
+
+	client := &FakeDockerClient{
+		FakeResults: map[string][]FakeResult{
+			"ContainerInspect": {
+				{nil, errGeneric},
+				{stoppedContainerInfo, nil},
+				{stoppedContainerInfo, nil},
+			},
+			"ContainerStart": {{nil}},
+		},
+	}
+
+	job := ContainerStartJob{
+		name:        "test_job",
+		client:      client,
+		containerID: "container_id",
+		retries:     1,
+		retryDelay:  time.Millisecond,
+	}
+
+	result := job.runOnce(context.Background())
+
+	var jobErr *JobError
+	if !errors.As(result.Err, &jobErr) {
+		t.Fatalf("Expected a JobError but got %v", result.Err)
+	}
+
+	ErrorUnequal(t, "test_job", jobErr.Job, "Unexpected job name in error")
+	ErrorUnequal(t, "get container details", jobErr.Op, "Unexpected operation in error")
+
+	if !errors.Is(result.Err, errGeneric) || !result.Failed() {
+		t.Errorf("Expected a failed result wrapping the Docker error but got %+v", result)
+	}
+
+	// The next attempt succeeds
+	jobRunner{job}.Run()
+
+	ErrorUnequal(t, 1, len(client.FakeCalls["ContainerStart"]), "Expected the container to be started")
+}
+
+// TestWatchDockerRetries checks that the main loop survives Docker being
+// unreachable and retries with backoff
+func TestWatchDockerRetries(t *testing.T) {
+	defer func(delay time.Duration) {
+		minDockerRetryDelay = delay
+	}(minDockerRetryDelay)
+
+	minDockerRetryDelay = time.Millisecond
+
+	croner := cron.New()
+	client := NewFakeDockerClient()
+
+	client.FakeResults["ContainerList"] = []FakeResult{
+		{nil, errGeneric},
+		{nil, errGeneric},
+		{[]dockerTypes.Container{
+			{
+				Names:  []string{"has_schedule_1"},
+				ID:     "has_schedule_1",
+				Labels: map[string]string{"dockron.schedule": "* * * * *"},
+			},
+		}, nil},
+		// Resync after losing the event stream
+		{[]dockerTypes.Container{
+			{
+				Names:  []string{"has_schedule_2"},
+				ID:     "has_schedule_2",
+				Labels: map[string]string{"dockron.schedule": "* * * * *"},
+			},
+		}, nil},
+	}
+	client.FakeResults["Events"] = []FakeResult{
+		{nil, errGeneric},
+		{nil, nil},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan bool)
+
+	go func() {
+		WatchDocker(ctx, client, croner, time.Hour)
+		done <- true
+	}()
+
+	expected := []string{"has_schedule_2/has_schedule_2"}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !reflect.DeepEqual(expected, sortedUniqueNames(croner)) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Give the loop a chance to resubscribe
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	if actual := sortedUniqueNames(croner); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected jobs %v but got %v", expected, actual)
+	}
+
+	ErrorUnequal(t, 4, len(client.FakeCalls["ContainerList"]), "Unexpected number of container queries")
+	ErrorUnequal(t, 2, len(client.FakeCalls["Events"]), "Expected events to be resubscribed")
+}
+
+// TestRunJobNow checks that a job can be found by name and run immediately
+func TestRunJobNow(t *testing.T) {
+	useFastPolling(t)
+
+	client := NewFakeDockerClient()
+	client.FakeResults["ContainerList"] = []FakeResult{
+		{[]dockerTypes.Container{
+			{
+				Names: []string{"/exec_job"},
+				ID:    "exec_job",
+				Labels: map[string]string{
+					"dockron.test.schedule": "@daily",
+					"dockron.test.command":  "echo ok",
+				},
+			},
+		}, nil},
+		{[]dockerTypes.Container{}, nil},
+	}
+	client.FakeResults["ContainerInspect"] = []FakeResult{
+		{runningContainerInfo, nil},
+	}
+	client.FakeResults["ContainerExecCreate"] = []FakeResult{
+		{dockerTypes.IDResponse{ID: "id"}, nil},
+	}
+	client.FakeResults["ContainerExecStart"] = []FakeResult{
+		{nil},
+	}
+	client.FakeResults["ContainerExecInspect"] = []FakeResult{
+		{container.ExecInspect{ExitCode: 2}, nil},
+	}
+
+	output := strings.Builder{}
+
+	result, err := RunJobNow(client, "exec_job/test", &output)
+	if err != nil {
+		t.Fatalf("Unexpected error running job: %v", err)
+	}
+
+	ErrorUnequal(t, resultFailure, result.Status(), "Unexpected result")
+	ErrorUnequal(t, 2, result.ExitCode, "Unexpected exit code")
+	ErrorUnequal(t, "Some output from our command\n", output.String(), "Unexpected output")
+
+	_, err = RunJobNow(client, "exec_job/test", &output)
+	if !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected job not found error but got %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/net/context"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the run duration histogram
+var durationBuckets = []float64{1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+// metrics collects statistics for all jobs
+var metrics = NewMetrics()
+
+// runKey identifies a counter of runs for a job with a given result
+type runKey struct {
+	job    string
+	result string
+}
+
+// histogram is a cumulative histogram of observed values
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// observe adds a value to the histogram
+func (h *histogram) observe(value float64) {
+	for i, bound := range durationBuckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += value
+}
+
+// Metrics collects statistics about scheduled jobs and their runs and
+// exposes them in the Prometheus text format
+type Metrics struct {
+	lock         sync.Mutex
+	runs         map[runKey]uint64
+	lastRun      map[string]time.Time
+	lastSuccess  map[string]time.Time
+	durations    map[string]*histogram
+	dockerErrors map[string]uint64
+	cron         *cron.Cron
+}
+
+// NewMetrics creates an empty set of metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		runs:         map[runKey]uint64{},
+		lastRun:      map[string]time.Time{},
+		lastSuccess:  map[string]time.Time{},
+		durations:    map[string]*histogram{},
+		dockerErrors: map[string]uint64{},
+	}
+}
+
+// ObserveRun records the result of a single run of a job
+func (m *Metrics) ObserveRun(jobName string, result JobResult, start time.Time, duration time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.runs[runKey{jobName, result.Status()}]++
+
+	if result.Skipped {
+		return
+	}
+
+	m.lastRun[jobName] = start
+
+	if result.Status() == resultSuccess {
+		m.lastSuccess[jobName] = start.Add(duration)
+	}
+
+	h, ok := m.durations[jobName]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.durations[jobName] = h
+	}
+
+	h.observe(duration.Seconds())
+}
+
+// ObserveSchedule records the cron used to schedule jobs so the number of
+// jobs and their next run times can be reported
+func (m *Metrics) ObserveSchedule(c *cron.Cron) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.cron = c
+}
+
+// ObserveDockerError records a failed call to the Docker API
+func (m *Metrics) ObserveDockerError(method string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.dockerErrors[method]++
+}
+
+// ServeHTTP writes all metrics in the Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.Write(w)
+}
+
+// Write writes all metrics in the Prometheus text format
+func (m *Metrics) Write(w io.Writer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	writeHeader(w, "dockron_job_runs_total", "counter", "Total number of job runs by result")
+
+	runKeys := make([]runKey, 0, len(m.runs))
+	for key := range m.runs {
+		runKeys = append(runKeys, key)
+	}
+
+	sort.Slice(runKeys, func(i, j int) bool {
+		if runKeys[i].job == runKeys[j].job {
+			return runKeys[i].result < runKeys[j].result
+		}
+
+		return runKeys[i].job < runKeys[j].job
+	})
+
+	for _, key := range runKeys {
+		writeSample(w, "dockron_job_runs_total", labels("job", key.job, "result", key.result), float64(m.runs[key]))
+	}
+
+	writeTimestamps(
+		w,
+		"dockron_job_last_run_timestamp_seconds",
+		"Unix time of the start of the last run of a job",
+		m.lastRun,
+	)
+	writeTimestamps(
+		w,
+		"dockron_job_last_success_timestamp_seconds",
+		"Unix time of the end of the last successful run of a job",
+		m.lastSuccess,
+	)
+
+	writeHeader(w, "dockron_job_run_duration_seconds", "histogram", "Duration of job runs")
+
+	for _, job := range sortedKeys(m.durations) {
+		h := m.durations[job]
+		for i, bound := range durationBuckets {
+			writeSample(
+				w,
+				"dockron_job_run_duration_seconds_bucket",
+				labels("job", job, "le", fmt.Sprint(bound)),
+				float64(h.counts[i]),
+			)
+		}
+
+		writeSample(w, "dockron_job_run_duration_seconds_bucket", labels("job", job, "le", "+Inf"), float64(h.count))
+		writeSample(w, "dockron_job_run_duration_seconds_sum", labels("job", job), h.sum)
+		writeSample(w, "dockron_job_run_duration_seconds_count", labels("job", job), float64(h.count))
+	}
+
+	nextRuns := map[string]time.Time{}
+	scheduledJobs := 0
+
+	if m.cron != nil {
+		for _, entry := range m.cron.Entries() {
+			scheduledJobs++
+
+			if !entry.Next.IsZero() {
+				nextRuns[entryJob(entry).Name()] = entry.Next
+			}
+		}
+	}
+
+	writeTimestamps(
+		w,
+		"dockron_job_next_run_timestamp_seconds",
+		"Unix time of the next scheduled run of a job",
+		nextRuns,
+	)
+
+	writeHeader(w, "dockron_scheduled_jobs", "gauge", "Number of jobs currently scheduled")
+	writeSample(w, "dockron_scheduled_jobs", "", float64(scheduledJobs))
+
+	writeHeader(w, "dockron_docker_api_errors_total", "counter", "Total number of failed Docker API calls by method")
+
+	for _, method := range sortedKeys(m.dockerErrors) {
+		writeSample(w, "dockron_docker_api_errors_total", labels("method", method), float64(m.dockerErrors[method]))
+	}
+}
+
+// writeHeader writes the help and type lines for a metric
+func writeHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeSample writes a single sample line for a metric
+func writeSample(w io.Writer, name, labels string, value float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// writeTimestamps writes a gauge of timestamps per job
+func writeTimestamps(w io.Writer, name, help string, timestamps map[string]time.Time) {
+	writeHeader(w, name, "gauge", help)
+
+	for _, job := range sortedKeys(timestamps) {
+		writeSample(w, name, labels("job", job), float64(timestamps[job].Unix()))
+	}
+}
+
+// labels formats pairs of label names and values
+func labels(pairs ...string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	parts := []string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], escaper.Replace(pairs[i+1])))
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// instrumentedClient wraps a ContainerClient and records failed calls
+type instrumentedClient struct {
+	client ContainerClient
+}
+
+// observe records an error for a method, if any, and returns it
+func (c instrumentedClient) observe(method string, err error) error {
+	if err != nil {
+		metrics.ObserveDockerError(method)
+	}
+
+	return err
+}
+
+func (c instrumentedClient) ContainerExecCreate(
+	ctx context.Context,
+	containerID string,
+	config container.ExecOptions,
+) (dockerTypes.IDResponse, error) {
+	resp, err := c.client.ContainerExecCreate(ctx, containerID, config)
+
+	return resp, c.observe("ContainerExecCreate", err)
+}
+
+func (c instrumentedClient) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	resp, err := c.client.ContainerExecInspect(ctx, execID)
+
+	return resp, c.observe("ContainerExecInspect", err)
+}
+
+func (c instrumentedClient) ContainerExecStart(ctx context.Context, execID string, config container.ExecStartOptions) error {
+	return c.observe("ContainerExecStart", c.client.ContainerExecStart(ctx, execID, config))
+}
+
+func (c instrumentedClient) ContainerExecAttach(
+	ctx context.Context,
+	execID string,
+	options container.ExecAttachOptions,
+) (dockerTypes.HijackedResponse, error) {
+	resp, err := c.client.ContainerExecAttach(ctx, execID, options)
+
+	return resp, c.observe("ContainerExecAttach", err)
+}
+
+func (c instrumentedClient) ContainerCreate(
+	ctx context.Context,
+	config *container.Config,
+	hostConfig *container.HostConfig,
+	networkingConfig *network.NetworkingConfig,
+	platform *ocispec.Platform,
+	containerName string,
+) (container.CreateResponse, error) {
+	resp, err := c.client.ContainerCreate(ctx, config, hostConfig, networkingConfig, platform, containerName)
+
+	return resp, c.observe("ContainerCreate", err)
+}
+
+func (c instrumentedClient) ContainerInspect(ctx context.Context, containerID string) (dockerTypes.ContainerJSON, error) {
+	resp, err := c.client.ContainerInspect(ctx, containerID)
+
+	return resp, c.observe("ContainerInspect", err)
+}
+
+func (c instrumentedClient) ContainerKill(ctx context.Context, containerID, signal string) error {
+	return c.observe("ContainerKill", c.client.ContainerKill(ctx, containerID, signal))
+}
+
+func (c instrumentedClient) ContainerList(ctx context.Context, options container.ListOptions) ([]dockerTypes.Container, error) {
+	resp, err := c.client.ContainerList(ctx, options)
+
+	return resp, c.observe("ContainerList", err)
+}
+
+func (c instrumentedClient) ContainerLogs(
+	ctx context.Context,
+	containerID string,
+	options container.LogsOptions,
+) (io.ReadCloser, error) {
+	resp, err := c.client.ContainerLogs(ctx, containerID, options)
+
+	return resp, c.observe("ContainerLogs", err)
+}
+
+func (c instrumentedClient) ContainerRemove(ctx context.Context, containerID string, options container.RemoveOptions) error {
+	return c.observe("ContainerRemove", c.client.ContainerRemove(ctx, containerID, options))
+}
+
+func (c instrumentedClient) ContainerRestart(ctx context.Context, containerID string, options container.StopOptions) error {
+	return c.observe("ContainerRestart", c.client.ContainerRestart(ctx, containerID, options))
+}
+
+func (c instrumentedClient) ContainerStart(ctx context.Context, containerID string, options container.StartOptions) error {
+	return c.observe("ContainerStart", c.client.ContainerStart(ctx, containerID, options))
+}
+
+func (c instrumentedClient) ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error {
+	return c.observe("ContainerStop", c.client.ContainerStop(ctx, containerID, options))
+}
+
+func (c instrumentedClient) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	messages, errs := c.client.Events(ctx, options)
+	observedErrs := make(chan error, 1)
+
+	go func() {
+		err := <-errs
+		if ctx.Err() == nil {
+			metrics.ObserveDockerError("Events")
+		}
+
+		observedErrs <- err
+	}()
+
+	return messages, observedErrs
+}
+
+func (c instrumentedClient) ImagePull(ctx context.Context, refStr string, options image.PullOptions) (io.ReadCloser, error) {
+	resp, err := c.client.ImagePull(ctx, refStr, options)
+
+	return resp, c.observe("ImagePull", err)
+}
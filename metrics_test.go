@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"golang.org/x/net/context"
+)
+
+// assertMetricLines checks that each expected line is present in the output
+func assertMetricLines(t *testing.T, output string, expectedLines []string) {
+	t.Helper()
+
+	lines := strings.Split(output, "\n")
+
+	for _, expected := range expectedLines {
+		found := false
+
+		for _, line := range lines {
+			if line == expected {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			t.Errorf("Expected metric line %q in output:\n%s", expected, output)
+		}
+	}
+}
+
+// TestMetricsWrite checks the Prometheus text format output of metrics
+func TestMetricsWrite(t *testing.T) {
+	m := NewMetrics()
+	start := time.Unix(1700000000, 0)
+
+	m.ObserveRun("/job_1", JobResult{}, start, 2*time.Second)
+	m.ObserveRun("/job_1", JobResult{ExitCode: 1}, start.Add(time.Minute), 90*time.Second)
+	m.ObserveRun("/job_1", JobResult{Skipped: true}, start.Add(2*time.Minute), 0)
+	m.ObserveRun(`/job"2`, JobResult{TimedOut: true}, start, time.Hour)
+	m.ObserveDockerError("ContainerInspect")
+	m.ObserveDockerError("ContainerInspect")
+
+	c := cron.New()
+	ScheduleJobs(c, []ContainerCronJob{
+		ContainerStartJob{name: "/job_1", containerID: "container_1", schedule: "* * * * *"},
+	})
+	m.ObserveSchedule(c)
+
+	output := bytes.Buffer{}
+	m.Write(&output)
+
+	assertMetricLines(t, output.String(), []string{
+		"# TYPE dockron_job_runs_total counter",
+		`dockron_job_runs_total{job="/job_1",result="failure"} 1`,
+		`dockron_job_runs_total{job="/job_1",result="skipped"} 1`,
+		`dockron_job_runs_total{job="/job_1",result="success"} 1`,
+		`dockron_job_runs_total{job="/job\"2",result="timeout"} 1`,
+		`dockron_job_last_run_timestamp_seconds{job="/job_1"} 1700000060`,
+		`dockron_job_last_success_timestamp_seconds{job="/job_1"} 1700000002`,
+		"# TYPE dockron_job_run_duration_seconds histogram",
+		`dockron_job_run_duration_seconds_bucket{job="/job_1",le="1"} 0`,
+		`dockron_job_run_duration_seconds_bucket{job="/job_1",le="5"} 1`,
+		`dockron_job_run_duration_seconds_bucket{job="/job_1",le="300"} 2`,
+		`dockron_job_run_duration_seconds_bucket{job="/job_1",le="+Inf"} 2`,
+		`dockron_job_run_duration_seconds_sum{job="/job_1"} 92`,
+		`dockron_job_run_duration_seconds_count{job="/job_1"} 2`,
+		"dockron_scheduled_jobs 1",
+		`dockron_docker_api_errors_total{method="ContainerInspect"} 2`,
+	})
+
+	// Next run is only known once the cron is started
+	if strings.Contains(output.String(), "dockron_job_next_run_timestamp_seconds{") {
+		t.Errorf("Expected no next run times before cron is started")
+	}
+
+	c.Start()
+	defer c.Stop()
+
+	output.Reset()
+	m.Write(&output)
+
+	if !strings.Contains(output.String(), `dockron_job_next_run_timestamp_seconds{job="/job_1"} `) {
+		t.Errorf("Expected next run time once cron is started. Got:\n%s", output.String())
+	}
+}
+
+// TestMetricsFromRuns checks that job runs and Docker errors are recorded
+func TestMetricsFromRuns(t *testing.T) {
+	defer func(m *Metrics) {
+		metrics = m
+	}(metrics)
+
+	metrics = NewMetrics()
+
+	client := instrumentedClient{&FakeDockerClient{
+		FakeResults: map[string][]FakeResult{
+			"ContainerInspect": {
+				{runningContainerInfo, nil},
+				{nil, errGeneric},
+			},
+		},
+	}}
+
+	job := ContainerStartJob{
+		name:        "/test_job",
+		client:      client,
+		containerID: "container_id",
+	}
+	jobRunner{job}.Run()
+
+	_, err := client.ContainerInspect(context.Background(), "container_id")
+	ErrorUnequal(t, errGeneric, err, "Expected error to be passed through")
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assertMetricLines(t, recorder.Body.String(), []string{
+		`dockron_job_runs_total{job="/test_job",result="skipped"} 1`,
+		`dockron_docker_api_errors_total{method="ContainerInspect"} 1`,
+	})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// NotifyPolicy determines which runs of a job send a notification
+type NotifyPolicy string
+
+const (
+	// NotifyFailure notifies when a run fails, times out or errors. This is
+	// the default
+	NotifyFailure NotifyPolicy = "failure"
+	// NotifySuccess notifies only when a run succeeds
+	NotifySuccess NotifyPolicy = "success"
+	// NotifyAlways notifies after every run that was not skipped
+	NotifyAlways NotifyPolicy = "always"
+	// NotifyTimeout notifies only when a run times out
+	NotifyTimeout NotifyPolicy = "timeout"
+)
+
+var (
+	// notifyWebhook is the URL notified about jobs without their own
+	notifyWebhook string
+	// notifyTimeout is the maximum time to wait for a webhook to respond
+	notifyTimeout = (10 * time.Second)
+	// notifyRetries is the number of times a failed notification is retried
+	notifyRetries = 3
+	// notifyRetryDelay is the delay before the first retry of a notification
+	notifyRetryDelay = (1 * time.Second)
+)
+
+// Notification is the payload sent to a webhook after a run of a job
+type Notification struct {
+	Job         string    `json:"job"`
+	UniqueName  string    `json:"uniqueName"`
+	ContainerID string    `json:"containerId"`
+	Schedule    string    `json:"schedule"`
+	Trigger     string    `json:"trigger"`
+	Status      string    `json:"status"`
+	ExitCode    int       `json:"exitCode"`
+	Attempt     int       `json:"attempt"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	// Duration is the length of the run in seconds
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+	// Output is the tail of the output of the run
+	Output string `json:"output,omitempty"`
+}
+
+// parseNotifyPolicy parses the value of a notify.on label
+func parseNotifyPolicy(val string) (NotifyPolicy, error) {
+	policy := NotifyPolicy(val)
+
+	switch policy {
+	case NotifyFailure, NotifySuccess, NotifyAlways, NotifyTimeout:
+		return policy, nil
+	default:
+		return "", fmt.Errorf(
+			"%w: notify.on %q must be one of failure, success, always or timeout",
+			ErrInvalidLabel,
+			val,
+		)
+	}
+}
+
+// parseWebhookURL checks that the value of a label is an absolute HTTP URL
+func parseWebhookURL(field, val string) (string, error) {
+	u, err := url.Parse(val)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%w: %s %q must be an http or https URL", ErrInvalidLabel, field, val)
+	}
+
+	return val, nil
+}
+
+// shouldNotify checks if a result matches a notify policy
+func shouldNotify(policy NotifyPolicy, result JobResult) bool {
+	switch policy {
+	case NotifySuccess:
+		return result.Status() == resultSuccess
+	case NotifyAlways:
+		return !result.Skipped
+	case NotifyTimeout:
+		return result.TimedOut
+	default:
+		return result.Failed()
+	}
+}
+
+// notify sends a notification about the final result of a run in the
+// background, if the job has a webhook and the result matches its policy
+func (job ContainerStartJob) notify(result JobResult, start, end time.Time) {
+	webhook := job.notifyURL
+	if webhook == "" {
+		webhook = notifyWebhook
+	}
+
+	if webhook == "" || !shouldNotify(job.notifyOn, result) {
+		return
+	}
+
+	notification := Notification{
+		Job:         job.name,
+		UniqueName:  job.UniqueName(),
+		ContainerID: job.containerID,
+		Schedule:    job.schedule,
+		Trigger:     job.triggerSource(),
+		Status:      result.Status(),
+		ExitCode:    result.ExitCode,
+		Attempt:     result.Attempt,
+		Start:       start,
+		End:         end,
+		Duration:    end.Sub(start).Seconds(),
+		Output:      result.Output,
+	}
+
+	if result.Err != nil {
+		notification.Error = result.Err.Error()
+	}
+
+	go func() {
+		err := SendNotification(webhook, notification)
+		logOnErrWarnf(err, "%s: Could not send notification: %v", job.name, err)
+	}()
+}
+
+// SendNotification posts a notification to a webhook. Requests that fail or
+// receive a server error are retried with backoff
+func SendNotification(webhook string, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("could not encode notification: %w", err)
+	}
+
+	return postWithRetries(webhook, "application/json", body)
+}
+
+// postWithRetries posts a body to a URL. Requests that fail or receive a
+// server error are retried with backoff
+func postWithRetries(webhookURL, contentType string, body []byte) error {
+	client := http.Client{Timeout: notifyTimeout}
+	delay := notifyRetryDelay
+
+	for attempt := 0; ; attempt++ {
+		retry, err := postOnce(&client, webhookURL, contentType, body)
+		if err == nil {
+			return nil
+		}
+
+		if !retry || attempt >= notifyRetries {
+			return err
+		}
+
+		logDebugf("Retrying request to %s in %s: %v", webhookURL, delay, err)
+		time.Sleep(delay)
+
+		delay *= 2
+	}
+}
+
+// postOnce makes a single request to a URL. It returns whether a failed
+// request should be retried
+func postOnce(client *http.Client, webhookURL, contentType string, body []byte) (bool, error) {
+	resp, err := client.Post(webhookURL, contentType, bytes.NewReader(body))
+	if err != nil {
+		return true, fmt.Errorf("%w: %w", ErrNotifyFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return true, fmt.Errorf("%w: %s", ErrNotifyFailed, resp.Status)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return false, fmt.Errorf("%w: %s", ErrNotifyFailed, resp.Status)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"golang.org/x/net/context"
+)
+
+// webhookServer starts a server that records notifications and responds
+// with each of the given statuses in turn, followed by 200
+func webhookServer(t *testing.T, statuses ...int) (*httptest.Server, <-chan Notification) {
+	t.Helper()
+
+	var lock sync.Mutex
+
+	notifications := make(chan Notification, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		notification := Notification{}
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Errorf("Could not decode notification: %v", err)
+		}
+
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+
+		notifications <- notification
+
+		if len(statuses) > 0 {
+			w.WriteHeader(statuses[0])
+			statuses = statuses[1:]
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	delay := notifyRetryDelay
+	notifyRetryDelay = time.Millisecond
+
+	t.Cleanup(func() {
+		notifyRetryDelay = delay
+	})
+
+	return server, notifications
+}
+
+// TestSendNotification checks that notifications are retried on server
+// errors but not on client errors
+func TestSendNotification(t *testing.T) {
+	cases := []struct {
+		name             string
+		statuses         []int
+		expectedRequests int
+		expectErr        bool
+	}{
+		{"Success", nil, 1, false},
+		{"Retried server errors", []int{http.StatusServiceUnavailable, http.StatusBadGateway}, 3, false},
+		{"Client error", []int{http.StatusBadRequest}, 1, true},
+		{
+			"Too many server errors",
+			[]int{
+				http.StatusInternalServerError,
+				http.StatusInternalServerError,
+				http.StatusInternalServerError,
+				http.StatusInternalServerError,
+			},
+			4,
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server, notifications := webhookServer(t, c.statuses...)
+
+			err := SendNotification(server.URL, Notification{Job: "job_1", ExitCode: 1})
+			if c.expectErr && !errors.Is(err, ErrNotifyFailed) {
+				t.Errorf("Expected notification to fail, got %v", err)
+			} else if !c.expectErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			ErrorUnequal(t, c.expectedRequests, len(notifications), "Unexpected number of requests")
+
+			for len(notifications) > 0 {
+				notification := <-notifications
+				ErrorUnequal(t, "job_1", notification.Job, "Unexpected job in payload")
+				ErrorUnequal(t, 1, notification.ExitCode, "Unexpected exit code in payload")
+			}
+		})
+	}
+}
+
+// TestJobNotifications checks that runs matching the notify policy of a job
+// send a notification with the result of the run
+func TestJobNotifications(t *testing.T) {
+	useFastPolling(t)
+
+	cases := []struct {
+		name         string
+		notifyOn     NotifyPolicy
+		exitCode     int
+		expectNotify bool
+	}{
+		{"Failure notified by default", "", 2, true},
+		{"Success not notified by default", "", 0, false},
+		{"Success notified", NotifySuccess, 0, true},
+		{"Failure notified always", NotifyAlways, 1, true},
+		{"Failure not notified on timeout", NotifyTimeout, 1, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server, notifications := webhookServer(t)
+
+			finalInspect := dockerTypes.ContainerJSON{
+				ContainerJSONBase: &dockerTypes.ContainerJSONBase{
+					State: &dockerTypes.ContainerState{Running: false, ExitCode: c.exitCode},
+				},
+			}
+
+			client := NewFakeDockerClient()
+			client.FakeResults["ContainerInspect"] = []FakeResult{
+				{stoppedContainerInfo, nil},
+				{finalInspect, nil},
+			}
+			client.FakeResults["ContainerStart"] = []FakeResult{
+				{nil},
+			}
+
+			job := ContainerStartJob{
+				client:      client,
+				context:     context.Background(),
+				name:        "notify_job",
+				containerID: "notify_container",
+				schedule:    "* * * * *",
+				notifyURL:   server.URL,
+				notifyOn:    c.notifyOn,
+			}
+			jobRunner{job}.Run()
+
+			select {
+			case notification := <-notifications:
+				if !c.expectNotify {
+					t.Fatalf("Unexpected notification %+v", notification)
+				}
+
+				ErrorUnequal(t, "notify_job", notification.Job, "Unexpected job in payload")
+				ErrorUnequal(t, "notify_container", notification.ContainerID, "Unexpected container in payload")
+				ErrorUnequal(t, "* * * * *", notification.Schedule, "Unexpected schedule in payload")
+				ErrorUnequal(t, c.exitCode, notification.ExitCode, "Unexpected exit code in payload")
+				ErrorUnequal(t, triggerSchedule, notification.Trigger, "Unexpected trigger in payload")
+
+				if notification.Duration < 0 || notification.End.Before(notification.Start) {
+					t.Errorf("Unexpected duration in payload %+v", notification)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if c.expectNotify {
+					t.Fatalf("Expected a notification")
+				}
+			}
+		})
+	}
+}
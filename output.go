@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/pkg/stdcopy"
+	"golang.org/x/net/context"
+)
+
+// defaultLogsLimit is the maximum number of bytes of container logs read
+// after a start job finishes
+const defaultLogsLimit = 64 * 1024
+
+// stdcopyHeaderLen is the length of the header of each frame of multiplexed
+// output from Docker
+const stdcopyHeaderLen = 8
+
+// stderrLevel is the level lines written to stderr by jobs are logged at
+var stderrLevel = levelWarning
+
+// runOutputKey is the context key of the writer receiving the output of a
+// manually triggered run
+type runOutputKey struct{}
+
+// withRunOutput returns a context for a run whose output is also written to
+// output, if not nil
+func withRunOutput(ctx context.Context, output io.Writer) context.Context {
+	if output == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, runOutputKey{}, output)
+}
+
+// runOutput returns the writer receiving the output of a run, if any
+func runOutput(ctx context.Context) io.Writer {
+	output, _ := ctx.Value(runOutputKey{}).(io.Writer)
+
+	return output
+}
+
+// parseLogLevel checks the name of a log level
+func parseLogLevel(level string) (string, error) {
+	switch level {
+	case levelDebug, levelInfo, levelWarning, levelError:
+		return level, nil
+	default:
+		return "", fmt.Errorf("%w: %q must be one of debug, info, warning or error", ErrInvalidLogLevel, level)
+	}
+}
+
+// lineWriter calls a function for each complete line written to it
+type lineWriter struct {
+	partial []byte
+	handle  func(line string)
+}
+
+// newLineWriter creates a lineWriter calling handle for each line
+func newLineWriter(handle func(line string)) *lineWriter {
+	return &lineWriter{handle: handle}
+}
+
+// Write splits the written bytes into lines, holding on to any incomplete
+// line until more is written or Flush is called
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.handle(string(bytes.TrimSuffix(w.partial[:i], []byte("\r"))))
+		w.partial = w.partial[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush handles any incomplete line remaining
+func (w *lineWriter) Flush() {
+	if len(w.partial) > 0 {
+		w.handle(string(w.partial))
+		w.partial = nil
+	}
+}
+
+// copyOutput copies the output of a container or exec to stdout and stderr.
+// Unless a TTY is attached, the streams are multiplexed by Docker and must be
+// separated. As it is not always known if a TTY is attached, the start of
+// the output is checked for the header of a multiplexed frame
+func copyOutput(stdout, stderr io.Writer, reader io.Reader) error {
+	buffered := bufio.NewReader(reader)
+
+	var err error
+	if isMultiplexed(buffered) {
+		_, err = stdcopy.StdCopy(stdout, stderr, buffered)
+	} else {
+		_, err = io.Copy(stdout, buffered)
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not read output: %w", err)
+	}
+
+	return nil
+}
+
+// isMultiplexed checks if output starts with the header of a multiplexed
+// frame. The header starts with the stream, followed by three zero bytes
+func isMultiplexed(reader *bufio.Reader) bool {
+	header, err := reader.Peek(stdcopyHeaderLen)
+	if err != nil {
+		return false
+	}
+
+	switch stdcopy.StdType(header[0]) {
+	case stdcopy.Stdin, stdcopy.Stdout, stdcopy.Stderr, stdcopy.Systemerr:
+		return header[1] == 0 && header[2] == 0 && header[3] == 0
+	default:
+		return false
+	}
+}
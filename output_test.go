@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"golang.org/x/net/context"
+)
+
+// framedOutput multiplexes output as Docker does for containers without a TTY
+func framedOutput(t *testing.T, stdout, stderr string) []byte {
+	t.Helper()
+
+	buf := bytes.Buffer{}
+
+	if _, err := stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(stdout)); err != nil {
+		t.Fatalf("Could not write stdout: %v", err)
+	}
+
+	if _, err := stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte(stderr)); err != nil {
+		t.Fatalf("Could not write stderr: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// TestLineWriter checks that output is split into lines across writes
+func TestLineWriter(t *testing.T) {
+	lines := []string{}
+	w := newLineWriter(func(line string) {
+		lines = append(lines, line)
+	})
+
+	_, _ = w.Write([]byte("first\r\nsec"))
+	_, _ = w.Write([]byte("ond\n\nlast"))
+	w.Flush()
+
+	expected := []string{"first", "second", "", "last"}
+	if !reflect.DeepEqual(expected, lines) {
+		t.Errorf("Expected lines %q but got %q", expected, lines)
+	}
+}
+
+// TestStartJobLogs checks that the output of a start job container is
+// collected after it exits
+func TestStartJobLogs(t *testing.T) {
+	useFastPolling(t)
+
+	ttyContainerInfo := dockerTypes.ContainerJSON{
+		ContainerJSONBase: stoppedContainerInfo.ContainerJSONBase,
+		Config:            &container.Config{Tty: true},
+	}
+
+	cases := []struct {
+		name           string
+		disableLogs    bool
+		finalInspect   dockerTypes.ContainerJSON
+		logs           []byte
+		expectedOutput string
+	}{
+		{
+			name:           "Multiplexed output",
+			finalInspect:   stoppedContainerInfo,
+			logs:           framedOutput(t, "out 1\nout 2\n", "err 1\n"),
+			expectedOutput: "out 1\nout 2\nerr 1\n",
+		},
+		{
+			name:           "TTY output",
+			finalInspect:   ttyContainerInfo,
+			logs:           []byte("line 1\r\nline 2"),
+			expectedOutput: "line 1\nline 2\n",
+		},
+		{
+			name:           "Logs disabled",
+			disableLogs:    true,
+			finalInspect:   stoppedContainerInfo,
+			expectedOutput: "",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := NewFakeDockerClient()
+			client.FakeResults["ContainerInspect"] = []FakeResult{
+				{stoppedContainerInfo, nil},
+				{c.finalInspect, nil},
+			}
+			client.FakeResults["ContainerStart"] = []FakeResult{
+				{nil},
+			}
+
+			if c.logs != nil {
+				client.FakeResults["ContainerLogs"] = []FakeResult{
+					{io.NopCloser(bytes.NewReader(c.logs)), nil},
+				}
+			}
+
+			job := ContainerStartJob{
+				client:      client,
+				context:     context.Background(),
+				name:        "start_job",
+				containerID: "start_job",
+				disableLogs: c.disableLogs,
+			}
+
+			output := strings.Builder{}
+			result := jobRunner{job}.RunNow(&output)
+
+			ErrorUnequal(t, c.expectedOutput, result.Output, "Unexpected result output")
+			ErrorUnequal(t, c.expectedOutput, output.String(), "Unexpected streamed output")
+
+			if c.logs != nil {
+				options := client.FakeCalls["ContainerLogs"][0][2].(container.LogsOptions)
+				if !options.ShowStdout || !options.ShowStderr || options.Since == "" {
+					t.Errorf("Expected logs of both streams since the run started, got %+v", options)
+				}
+			}
+		})
+	}
+}
+
+// TestExecJobOutput checks that stdout and stderr of an exec are separated
+// whether or not the output is multiplexed
+func TestExecJobOutput(t *testing.T) {
+	useFastPolling(t)
+
+	cases := []struct {
+		name           string
+		stream         []byte
+		expectedOutput string
+		expectedStderr []Fields
+	}{
+		{
+			name:           "Multiplexed output",
+			stream:         framedOutput(t, "out 1\nout 2\n", "err 1\n"),
+			expectedOutput: "out 1\nout 2\nerr 1\n",
+			expectedStderr: []Fields{{
+				"level":        levelWarning,
+				"msg":          "exec_job: Exec error output: err 1",
+				"event":        eventOutput,
+				"stream":       "stderr",
+				"job":          "exec_job",
+				"unique_name":  "exec_job/container_id",
+				"container_id": "container_id",
+			}},
+		},
+		{
+			name:           "TTY output",
+			stream:         []byte("out 1\r\nerr 1\r\n"),
+			expectedOutput: "out 1\nerr 1\n",
+			expectedStderr: []Fields{},
+		},
+		{
+			name:           "No output",
+			stream:         []byte{},
+			expectedOutput: "",
+			expectedStderr: []Fields{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			readLogs := captureLogs(t)
+
+			conn, _ := net.Pipe()
+
+			client := NewFakeDockerClient()
+			client.FakeResults["ContainerInspect"] = []FakeResult{
+				{runningContainerInfo, nil},
+			}
+			client.FakeResults["ContainerExecCreate"] = []FakeResult{
+				{dockerTypes.IDResponse{ID: "id"}, nil},
+			}
+			client.FakeResults["ContainerExecAttach"] = []FakeResult{
+				{dockerTypes.HijackedResponse{Conn: conn, Reader: bufio.NewReader(bytes.NewReader(c.stream))}, nil},
+			}
+			client.FakeResults["ContainerExecStart"] = []FakeResult{
+				{nil},
+			}
+			client.FakeResults["ContainerExecInspect"] = []FakeResult{
+				{container.ExecInspect{}, nil},
+			}
+
+			job := ContainerExecJob{
+				ContainerStartJob: ContainerStartJob{
+					client:      client,
+					context:     context.Background(),
+					name:        "exec_job",
+					containerID: "container_id",
+				},
+				shellCommand: "date",
+			}
+
+			output := strings.Builder{}
+			result := jobRunner{job}.RunNow(&output)
+
+			ErrorUnequal(t, c.expectedOutput, result.Output, "Unexpected output")
+			ErrorUnequal(t, c.expectedOutput, output.String(), "Unexpected streamed output")
+
+			stderrLines := []Fields{}
+
+			for _, entry := range eventEntries(readLogs(), eventOutput) {
+				if entry["stream"] == "stderr" {
+					delete(entry, "time")
+					stderrLines = append(stderrLines, entry)
+				}
+			}
+
+			if !reflect.DeepEqual(c.expectedStderr, stderrLines) {
+				t.Errorf("Expected stderr lines %+v but got %+v", c.expectedStderr, stderrLines)
+			}
+		})
+	}
+}
+
+// TestParseLogLevel checks the levels that output to stderr can be logged at
+func TestParseLogLevel(t *testing.T) {
+	for _, level := range []string{"debug", "info", "warning", "error"} {
+		if _, err := parseLogLevel(level); err != nil {
+			t.Errorf("Unexpected error parsing %s: %v", level, err)
+		}
+	}
+
+	if _, err := parseLogLevel("loud"); !errors.Is(err, ErrInvalidLogLevel) {
+		t.Errorf("Expected an invalid log level error, got %v", err)
+	}
+}
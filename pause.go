@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// pausedJobs tracks jobs that have been paused at runtime
+var pausedJobs = newPauseRegistry()
+
+// pausedJob is a job that has been removed from the cron until resumed
+type pausedJob struct {
+	job ContainerCronJob
+	// until is when the job will be resumed automatically. If zero, the job
+	// is paused until resumed manually
+	until time.Time
+	// timer resumes the job once until has passed
+	timer *time.Timer
+}
+
+// pauseRegistry tracks paused jobs by unique name
+type pauseRegistry struct {
+	lock sync.Mutex
+	jobs map[string]pausedJob
+}
+
+// newPauseRegistry creates an empty pauseRegistry
+func newPauseRegistry() *pauseRegistry {
+	return &pauseRegistry{jobs: map[string]pausedJob{}}
+}
+
+// pause records a job as paused, replacing any previous pause. If until is
+// not zero, resume is called once it has passed
+func (registry *pauseRegistry) pause(job ContainerCronJob, until time.Time, resume func()) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	if previous, ok := registry.jobs[job.UniqueName()]; ok && previous.timer != nil {
+		previous.timer.Stop()
+	}
+
+	paused := pausedJob{job: job, until: until}
+	if !until.IsZero() {
+		paused.timer = time.AfterFunc(time.Until(until), resume)
+	}
+
+	registry.jobs[job.UniqueName()] = paused
+}
+
+// resume forgets a paused job and returns it
+func (registry *pauseRegistry) resume(uniqueName string) (ContainerCronJob, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	paused, ok := registry.jobs[uniqueName]
+	if !ok {
+		return nil, false
+	}
+
+	if paused.timer != nil {
+		paused.timer.Stop()
+	}
+
+	delete(registry.jobs, uniqueName)
+
+	return paused.job, true
+}
+
+// refresh replaces a paused job with a newer copy from Docker. It returns
+// false if the job is not paused
+func (registry *pauseRegistry) refresh(job ContainerCronJob) bool {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	paused, ok := registry.jobs[job.UniqueName()]
+	if ok {
+		paused.job = job
+		registry.jobs[job.UniqueName()] = paused
+	}
+
+	return ok
+}
+
+// forget removes paused jobs matching remove, such as those whose containers
+// no longer exist
+func (registry *pauseRegistry) forget(remove func(ContainerCronJob) bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for uniqueName, paused := range registry.jobs {
+		if remove(paused.job) {
+			if paused.timer != nil {
+				paused.timer.Stop()
+			}
+
+			delete(registry.jobs, uniqueName)
+		}
+	}
+}
+
+// find returns a paused job by name or unique name
+func (registry *pauseRegistry) find(name string) (pausedJob, bool) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	for _, paused := range registry.jobs {
+		if jobMatches(paused.job, name) {
+			return paused, true
+		}
+	}
+
+	return pausedJob{}, false
+}
+
+// list returns all paused jobs
+func (registry *pauseRegistry) list() []pausedJob {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+
+	jobs := make([]pausedJob, 0, len(registry.jobs))
+	for _, paused := range registry.jobs {
+		jobs = append(jobs, paused)
+	}
+
+	return jobs
+}
+
+// PauseJob removes a job from the cron so it will not run until resumed. If
+// until is not zero, the job is resumed automatically at that time. Pausing
+// a job that is already paused replaces when it will be resumed
+func PauseJob(c *cron.Cron, name string, until time.Time) (ContainerCronJob, error) {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+
+	var (
+		job     ContainerCronJob
+		entryID cron.EntryID
+	)
+
+	if paused, ok := pausedJobs.find(name); ok {
+		job = paused.job
+	} else {
+		for _, entry := range c.Entries() {
+			if entryJob := entryJob(entry); jobMatches(entryJob, name) {
+				job, entryID = entryJob, entry.ID
+
+				break
+			}
+		}
+	}
+
+	if job == nil {
+		job, _ = jobGraph.findUnscheduled(name)
+	}
+
+	if job == nil {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+
+	uniqueName := job.UniqueName()
+	pausedJobs.pause(job, until, func() {
+		resumeExpired(c, uniqueName)
+	})
+
+	if entryID != 0 {
+		c.Remove(entryID)
+	}
+
+	metrics.ObserveSchedule(c)
+
+	if until.IsZero() {
+		logInfof("Paused %s (%s)", job.Name(), uniqueName)
+	} else {
+		logInfof("Paused %s (%s) until %s", job.Name(), uniqueName, until.Format(time.RFC3339))
+	}
+
+	return job, nil
+}
+
+// ResumeJob adds a paused job back to the cron. Resuming a job that is not
+// paused has no effect
+func ResumeJob(c *cron.Cron, name string) (ContainerCronJob, error) {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+
+	paused, ok := pausedJobs.find(name)
+	if !ok {
+		for _, entry := range c.Entries() {
+			if job := entryJob(entry); jobMatches(job, name) {
+				return job, nil
+			}
+		}
+
+		if job, ok := jobGraph.findUnscheduled(name); ok {
+			return job, nil
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+
+	return resumePaused(c, paused.job.UniqueName())
+}
+
+// resumeExpired resumes a paused job if its pause has expired. The job may
+// have been resumed or paused again since the timer was started
+func resumeExpired(c *cron.Cron, uniqueName string) {
+	scheduleLock.Lock()
+	defer scheduleLock.Unlock()
+
+	paused, ok := pausedJobs.find(uniqueName)
+	if !ok || paused.until.IsZero() || time.Now().Before(paused.until) {
+		return
+	}
+
+	logInfof("%s: Pause expired", paused.job.Name())
+
+	_, err := resumePaused(c, uniqueName)
+	logOnErrWarnf(err, "%s: Could not resume job: %v", paused.job.Name(), err)
+}
+
+// resumePaused adds a paused job back to the cron. The schedule lock must be
+// held by the caller
+func resumePaused(c *cron.Cron, uniqueName string) (ContainerCronJob, error) {
+	job, ok := pausedJobs.resume(uniqueName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, uniqueName)
+	}
+
+	// Jobs without a schedule only need to be triggerable again
+	if job.Schedule() != "" {
+		if _, err := addJob(c, job); err != nil {
+			return nil, fmt.Errorf("could not schedule %s: %w", job.Name(), err)
+		}
+	}
+
+	metrics.ObserveSchedule(c)
+	logInfof("Resumed %s (%s)", job.Name(), job.UniqueName())
+
+	return job, nil
+}
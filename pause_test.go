@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// TestPauseJobs checks that paused jobs stay unscheduled until resumed
+func TestPauseJobs(t *testing.T) {
+	defer func(registry *pauseRegistry) {
+		pausedJobs = registry
+	}(pausedJobs)
+
+	pausedJobs = newPauseRegistry()
+	croner := cron.New()
+
+	jobs := []ContainerCronJob{
+		ContainerStartJob{name: "/job_1", containerID: "container_1", schedule: "* * * * *"},
+		ContainerStartJob{name: "/job_2", containerID: "container_2", schedule: "* * * * *"},
+	}
+
+	ScheduleJobs(croner, jobs)
+
+	if _, err := PauseJob(croner, "job_1", time.Time{}); err != nil {
+		t.Fatalf("Unexpected error pausing job: %v", err)
+	}
+
+	// Rescheduling should not add the paused job back
+	ScheduleJobs(croner, jobs)
+
+	expected := []string{"/job_2/container_2"}
+	if actual := sortedUniqueNames(croner); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected jobs %v after pausing but got %v", expected, actual)
+	}
+
+	if _, err := PauseJob(croner, "missing", time.Time{}); err == nil {
+		t.Errorf("Expected an error pausing a missing job")
+	}
+
+	if _, err := ResumeJob(croner, "/job_1/container_1"); err != nil {
+		t.Fatalf("Unexpected error resuming job: %v", err)
+	}
+
+	ScheduleJobs(croner, jobs)
+
+	expected = []string{"/job_1/container_1", "/job_2/container_2"}
+	if actual := sortedUniqueNames(croner); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected jobs %v after resuming but got %v", expected, actual)
+	}
+
+	// Paused jobs for removed containers are forgotten
+	if _, err := PauseJob(croner, "job_2", time.Time{}); err != nil {
+		t.Fatalf("Unexpected error pausing job: %v", err)
+	}
+
+	ScheduleJobs(croner, jobs[:1])
+
+	if _, ok := pausedJobs.find("job_2"); ok {
+		t.Errorf("Expected paused job for removed container to be forgotten")
+	}
+}
+
+// TestPauseJobExpires checks that a job paused for a duration is resumed
+// automatically
+func TestPauseJobExpires(t *testing.T) {
+	defer func(registry *pauseRegistry) {
+		pausedJobs = registry
+	}(pausedJobs)
+
+	pausedJobs = newPauseRegistry()
+	croner := cron.New()
+
+	ScheduleJobs(croner, []ContainerCronJob{
+		ContainerStartJob{name: "/job_1", containerID: "container_1", schedule: "* * * * *"},
+	})
+
+	if _, err := PauseJob(croner, "job_1", time.Now().Add(10*time.Millisecond)); err != nil {
+		t.Fatalf("Unexpected error pausing job: %v", err)
+	}
+
+	ErrorUnequal(t, 0, len(croner.Entries()), "Expected job to be paused")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(croner.Entries()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ErrorUnequal(t, 1, len(croner.Entries()), "Expected job to be resumed")
+}
+
+// TestPauseAPI checks that jobs can be paused and resumed over HTTP, as the
+// pause and resume commands do
+func TestPauseAPI(t *testing.T) {
+	defer func(registry *pauseRegistry) {
+		pausedJobs = registry
+	}(pausedJobs)
+
+	pausedJobs = newPauseRegistry()
+	croner := cron.New()
+
+	ScheduleJobs(croner, []ContainerCronJob{
+		ContainerStartJob{name: "/job_1", containerID: "container_1", schedule: "* * * * *"},
+	})
+
+	croner.Start()
+	defer croner.Stop()
+
+	server := httptest.NewServer(NewServeMux(NewAPI(croner)))
+	defer server.Close()
+
+	httpAddr := strings.TrimPrefix(server.URL, "http://")
+
+	useAPIToken(t, "secret")
+
+	recorder := httptest.NewRecorder()
+	server.Config.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/jobs/job_1/pause", nil))
+	ErrorUnequal(t, http.StatusUnauthorized, recorder.Code, "Expected pause to require the token")
+
+	info, err := postJobAction(httpAddr, "/job_1/container_1", "pause", map[string][]string{"for": {"1h"}})
+	if err != nil {
+		t.Fatalf("Unexpected error pausing job: %v", err)
+	}
+
+	ErrorUnequal(t, true, info.Paused, "Expected job to be paused")
+
+	if info.PausedUntil == nil {
+		t.Errorf("Expected job to be paused until a time")
+	}
+
+	jobs := []JobInfo{}
+	getJSON(t, server.Config.Handler, "/jobs", &jobs)
+
+	if len(jobs) != 1 || !jobs[0].Paused {
+		t.Errorf("Expected paused job to be listed, got %+v", jobs)
+	}
+
+	info, err = postJobAction(httpAddr, "job_1", "resume", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error resuming job: %v", err)
+	}
+
+	ErrorUnequal(t, false, info.Paused, "Expected job to be resumed")
+
+	if info.Next == nil {
+		t.Errorf("Expected resumed job to have a next run")
+	}
+
+	_, err = postJobAction(httpAddr, "job_1", "pause", map[string][]string{"for": {"soon"}})
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Expected a bad request error for an invalid duration, got %v", err)
+	}
+
+	_, err = postJobAction(httpAddr, "missing", "resume", nil)
+	if err == nil || !strings.Contains(err.Error(), http.StatusText(http.StatusNotFound)) {
+		t.Errorf("Expected a not found error for a missing job, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// runStartedKey is the context key of the function called once a run has
+// passed its checks and is actually starting
+type runStartedKey struct{}
+
+// withRunStarted returns a context that calls started when a run started
+// with it is marked as started
+func withRunStarted(ctx context.Context, started func()) context.Context {
+	return context.WithValue(ctx, runStartedKey{}, started)
+}
+
+// markRunStarted marks a run as started once it is no longer going to be
+// skipped
+func markRunStarted(ctx context.Context) {
+	if started, ok := ctx.Value(runStartedKey{}).(func()); ok {
+		started()
+	}
+}
+
+// runPinger sends the pings of a single run of a job, which may be made up
+// of several attempts
+type runPinger struct {
+	job  ContainerStartJob
+	once sync.Once
+	// done is closed once the start ping has been sent, or once it is known
+	// that the run never started, so the result ping is not received first
+	done chan bool
+}
+
+// newRunPinger creates a runPinger for a run of the job
+func (job ContainerStartJob) newRunPinger() *runPinger {
+	return &runPinger{job: job, done: make(chan bool)}
+}
+
+// start sends the start ping in the background, if the job has a ping URL.
+// Only the first call for a run sends a ping
+func (p *runPinger) start() {
+	if p.job.pingURL == "" {
+		return
+	}
+
+	p.once.Do(func() {
+		go func() {
+			defer close(p.done)
+
+			p.job.ping("start", "")
+		}()
+	})
+}
+
+// result sends a success ping if the run succeeded, or a fail ping with the
+// exit code and output of the run otherwise. It is sent in the background
+// after any start ping. Skipped runs are not pinged
+func (p *runPinger) result(result JobResult) {
+	if p.job.pingURL == "" || result.Skipped {
+		return
+	}
+
+	// Stop waiting for a start ping if the run never started
+	p.once.Do(func() { close(p.done) })
+
+	go func() {
+		<-p.done
+
+		if result.Status() == resultSuccess {
+			p.job.ping("success", result.Output)
+
+			return
+		}
+
+		body := fmt.Sprintf("Status: %s\nExit code: %d\n", result.Status(), result.ExitCode)
+		if result.Err != nil {
+			body += fmt.Sprintf("Error: %v\n", result.Err)
+		}
+
+		if result.Output != "" {
+			body += "\n" + result.Output
+		}
+
+		p.job.ping("fail", body)
+	}()
+}
+
+// ping posts a body to the ping URL of the job. Success is pinged at the
+// URL itself while other events are appended to its path
+func (job ContainerStartJob) ping(event, body string) {
+	pingURL, err := url.Parse(job.pingURL)
+	if err != nil {
+		logWarningf("%s: Could not send %s ping: %v", job.name, event, err)
+
+		return
+	}
+
+	if event != "success" {
+		pingURL = pingURL.JoinPath(event)
+	}
+
+	err = postWithRetries(pingURL.String(), "text/plain; charset=utf-8", []byte(body))
+	logOnErrWarnf(err, "%s: Could not send %s ping: %v", job.name, event, err)
+}
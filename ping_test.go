@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"golang.org/x/net/context"
+)
+
+// ping is a request received by a ping server
+type ping struct {
+	path  string
+	query string
+	body  string
+}
+
+// TestJobPings checks that runs send a start ping followed by a success or
+// fail ping, and that skipped runs are not pinged at all
+func TestJobPings(t *testing.T) {
+	useFastPolling(t)
+
+	cases := []struct {
+		name          string
+		exitCode      int
+		running       bool
+		expectedPings []string
+		expectedBody  string
+	}{
+		{"Success", 0, false, []string{"/ping/start", "/ping/"}, ""},
+		{"Failure", 3, false, []string{"/ping/start", "/ping/fail"}, "Status: failure\nExit code: 3\n"},
+		{"Skipped", 0, true, []string{}, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var lock sync.Mutex
+
+			pings := make(chan ping, 10)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				defer lock.Unlock()
+
+				body, _ := io.ReadAll(r.Body)
+				pings <- ping{r.URL.Path, r.URL.RawQuery, string(body)}
+			}))
+			defer server.Close()
+
+			client := NewFakeDockerClient()
+			client.FakeResults["ContainerInspect"] = []FakeResult{
+				{dockerTypes.ContainerJSON{
+					ContainerJSONBase: &dockerTypes.ContainerJSONBase{
+						State: &dockerTypes.ContainerState{Running: c.running},
+					},
+				}, nil},
+				{dockerTypes.ContainerJSON{
+					ContainerJSONBase: &dockerTypes.ContainerJSONBase{
+						State: &dockerTypes.ContainerState{Running: false, ExitCode: c.exitCode},
+					},
+				}, nil},
+			}
+			client.FakeResults["ContainerStart"] = []FakeResult{
+				{nil},
+			}
+
+			job := ContainerStartJob{
+				client:      client,
+				context:     context.Background(),
+				name:        "ping_job",
+				containerID: "ping_job",
+				pingURL:     server.URL + "/ping/?rid=1",
+			}
+			jobRunner{job}.Run()
+
+			received := []ping{}
+
+			for len(received) < len(c.expectedPings) {
+				select {
+				case p := <-pings:
+					received = append(received, p)
+				case <-time.After(time.Second):
+					t.Fatalf("Expected pings %v, got %+v", c.expectedPings, received)
+				}
+			}
+
+			select {
+			case p := <-pings:
+				t.Fatalf("Unexpected ping %+v after %+v", p, received)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			if len(received) == 0 {
+				return
+			}
+
+			for i, path := range c.expectedPings {
+				ErrorUnequal(t, path, received[i].path, "Unexpected ping path")
+				ErrorUnequal(t, "rid=1", received[i].query, "Unexpected ping query")
+			}
+
+			ErrorUnequal(t, c.expectedBody, received[len(received)-1].body, "Unexpected body of result ping")
+
+			if strings.Contains(received[0].body, "Status") {
+				t.Errorf("Expected an empty start ping, got %q", received[0].body)
+			}
+		})
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	dockerClient "github.com/docker/docker/client"
+	"golang.org/x/net/context"
+)
+
+// runJobLabel is the label added to containers created by a run job. Its
+// value is the name of the job, which unlike the unique name doesn't change
+// when dockron is recreated
+const runJobLabel = "dockron.run.job"
+
+var (
+	// selfContainerID is the full ID of the container dockron is running in.
+	// Run jobs can only be configured with its labels. If empty, run jobs
+	// can't be configured with labels at all
+	selfContainerID string
+	// jobsFile is the path of a JSON file configuring run jobs. Disabled if
+	// empty
+	jobsFile string
+)
+
+// ContainerRunJob is a scheduled job that creates a new container from an
+// image for each run and removes it afterwards
+type ContainerRunJob struct {
+	ContainerExecJob
+	image string
+	// mounts are the volumes and bind mounts of the container
+	mounts []mount.Mount
+	// network is the network the container is connected to. Defaults to the
+	// default network of Docker
+	network string
+	// keep is the number of containers of finished runs kept for debugging
+	keep int
+}
+
+// Type returns the type of the job
+func (job ContainerRunJob) Type() string {
+	return "run"
+}
+
+// runOnce creates a new container and waits for it to exit, stopping it if
+// the run context is done before then. Containers of old runs beyond the
+// number to keep are removed afterwards
+func (job ContainerRunJob) runOnce(runCtx context.Context) JobResult {
+	logEvent(levelInfo, jobFields(job, eventStarted), "Running: %s", job.name)
+	markRunStarted(runCtx)
+
+	start := time.Now()
+
+	containerID, err := job.createContainer()
+	if err != nil {
+		return job.errorResult("create container", err)
+	}
+	defer job.removeOldContainers()
+
+	// instance is the job acting on the new container
+	instance := job.ContainerStartJob
+	instance.containerID = containerID
+
+	err = job.client.ContainerStart(job.context, containerID, container.StartOptions{})
+	if err != nil {
+		return job.errorResult("start container", err)
+	}
+
+	for {
+		if err := runCtx.Err(); err != nil {
+			instance.stopContainer(err)
+
+			result := interruptedResult(err)
+			result.Output = instance.logOutput(runCtx, start)
+
+			return result
+		}
+
+		containerJSON, err := job.client.ContainerInspect(job.context, containerID)
+		if err != nil {
+			return job.errorResult("get container details", err)
+		}
+
+		if !containerJSON.State.Running {
+			logDebugf("%s: Done running. %+v", job.name, containerJSON.State)
+
+			return JobResult{
+				ExitCode: containerJSON.State.ExitCode,
+				Output:   instance.logOutput(runCtx, start),
+			}
+		}
+
+		logDebugf("%s: Still running", job.name)
+		time.Sleep(pollInterval)
+	}
+}
+
+// createContainer creates the container for a run, pulling the image first
+// if it is missing, and returns its ID
+func (job ContainerRunJob) createContainer() (string, error) {
+	config := &container.Config{
+		Image:      job.image,
+		Cmd:        job.runCmd(),
+		Env:        job.env,
+		User:       job.user,
+		WorkingDir: job.workdir,
+		Labels:     map[string]string{runJobLabel: job.name},
+	}
+	hostConfig := &container.HostConfig{
+		Mounts:      job.mounts,
+		NetworkMode: container.NetworkMode(job.network),
+		Privileged:  job.privileged,
+	}
+
+	resp, err := job.client.ContainerCreate(job.context, config, hostConfig, nil, nil, "")
+	if dockerClient.IsErrNotFound(err) {
+		if err := job.pullImage(); err != nil {
+			return "", err
+		}
+
+		resp, err = job.client.ContainerCreate(job.context, config, hostConfig, nil, nil, "")
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, warning := range resp.Warnings {
+		logWarningf("%s: %s", job.name, warning)
+	}
+
+	return resp.ID, nil
+}
+
+// pullImage pulls the image of the job and waits for the pull to finish
+func (job ContainerRunJob) pullImage() error {
+	logInfof("%s: Pulling image %s", job.name, job.image)
+
+	reader, err := job.client.ImagePull(job.context, job.image, image.PullOptions{})
+	if err != nil {
+		return fmt.Errorf("could not pull image %s: %w", job.image, err)
+	}
+	defer reader.Close()
+
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return fmt.Errorf("could not pull image %s: %w", job.image, err)
+	}
+
+	return nil
+}
+
+// runCmd returns the command to run in the container. If no command is set,
+// the default command of the image is used
+func (job ContainerRunJob) runCmd() []string {
+	if job.shellCommand == "" && len(job.execCmd) == 0 {
+		return nil
+	}
+
+	return job.cmd()
+}
+
+// removeOldContainers removes the stopped containers of previous runs of the
+// job, keeping the newest ones up to the number to keep
+func (job ContainerRunJob) removeOldContainers() {
+	containers, err := job.client.ContainerList(job.context, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", runJobLabel+"="+job.name)),
+	})
+	if err != nil {
+		logWarningf("%s: Could not list containers of previous runs: %v", job.name, err)
+
+		return
+	}
+
+	sort.SliceStable(containers, func(i, j int) bool {
+		return containers[i].Created > containers[j].Created
+	})
+
+	kept := 0
+
+	for _, c := range containers {
+		// Containers of other runs may still be running
+		if c.State == "running" {
+			continue
+		}
+
+		if kept < job.keep {
+			kept++
+
+			continue
+		}
+
+		logDebugf("%s: Removing container %s", job.name, c.ID)
+
+		err := job.client.ContainerRemove(job.context, c.ID, container.RemoveOptions{RemoveVolumes: true})
+		logOnErrWarnf(err, "%s: Could not remove container %s: %v", job.name, c.ID, err)
+	}
+}
+
+// newRunJob builds a run job from a map of label fields to values
+func newRunJob(client ContainerClient, containerID, name string, config map[string]string) (ContainerRunJob, error) {
+	job := ContainerRunJob{
+		ContainerExecJob: ContainerExecJob{
+			ContainerStartJob: ContainerStartJob{
+				client:      client,
+				containerID: containerID,
+				context:     context.Background(),
+				schedule:    config["schedule"],
+				name:        name,
+			},
+			shellCommand: config["command"],
+		},
+	}
+
+	if err := configureJob(&job.ContainerStartJob, config); err != nil {
+		return job, err
+	}
+
+	if err := configureExecJob(&job.ContainerExecJob, config); err != nil {
+		return job, err
+	}
+
+	return job, configureRunJob(&job, config)
+}
+
+// configureRunJob applies the settings of run jobs from a map of label fields
+// to values
+func configureRunJob(job *ContainerRunJob, config map[string]string) (err error) {
+	job.image = strings.TrimSpace(config["image"])
+	if job.image == "" {
+		return fmt.Errorf("%w: image must not be empty", ErrInvalidLabel)
+	}
+
+	if _, ok := config["signal"]; ok {
+		return fmt.Errorf("%w: signal can't be used with image", ErrInvalidLabel)
+	}
+
+	job.network = config["network"]
+
+	if val, ok := config["mounts"]; ok {
+		if job.mounts, err = parseMounts(val); err != nil {
+			return err
+		}
+	}
+
+	if val, ok := config["keep"]; ok {
+		job.keep, err = strconv.Atoi(val)
+		if err != nil || job.keep < 0 {
+			return fmt.Errorf("%w: keep %q must be a non-negative integer", ErrInvalidLabel, val)
+		}
+	}
+
+	return nil
+}
+
+// parseMounts parses a comma separated list of mounts in the form
+// source:target or source:target:ro. Sources starting with a slash are bind
+// mounted while others are named volumes
+func parseMounts(val string) ([]mount.Mount, error) {
+	mounts := []mount.Mount{}
+
+	for _, spec := range strings.Split(val, ",") {
+		parts := strings.Split(strings.TrimSpace(spec), ":")
+
+		valid := len(parts) == 2 || (len(parts) == 3 && (parts[2] == "ro" || parts[2] == "rw"))
+		if !valid || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf(
+				"%w: mounts %q must be a comma separated list of source:target or source:target:ro",
+				ErrInvalidLabel,
+				val,
+			)
+		}
+
+		m := mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   parts[0],
+			Target:   parts[1],
+			ReadOnly: len(parts) == 3 && parts[2] == "ro",
+		}
+
+		if strings.HasPrefix(m.Source, "/") {
+			m.Type = mount.TypeBind
+		}
+
+		mounts = append(mounts, m)
+	}
+
+	return mounts, nil
+}
+
+// isSelf checks if a container is the one dockron is running in
+func isSelf(containerID string) bool {
+	return selfContainerID != "" && containerID == selfContainerID
+}
+
+// resolveSelfContainer finds the full ID of the container dockron is running
+// in from the ID or name given with -container-id. If none was given, the
+// container is found by hostname, which Docker sets to the short ID of the
+// container by default, and must have the same hostname. An empty string is
+// returned if the container can't be found
+func resolveSelfContainer(client ContainerClient, containerID, hostname string) string {
+	lookup := containerID
+	if lookup == "" {
+		lookup = hostname
+	}
+
+	if lookup == "" {
+		return ""
+	}
+
+	containerJSON, err := client.ContainerInspect(context.Background(), lookup)
+	if err != nil || containerJSON.ContainerJSONBase == nil {
+		logWarningf("Could not find the container dockron is running in. Run jobs can't be configured with labels: %v", err)
+
+		return ""
+	}
+
+	// Without an explicit ID, make sure the hostname wasn't matched to the
+	// name or ID prefix of another container
+	if containerID == "" && (containerJSON.Config == nil || containerJSON.Config.Hostname != hostname) {
+		logWarningf(
+			"Container %s found for hostname %s has a different hostname. Run jobs can't be configured with labels. "+
+				"Pass -container-id to configure them",
+			containerJSON.ID,
+			hostname,
+		)
+
+		return ""
+	}
+
+	return containerJSON.ID
+}
+
+// queryFileJobs builds run jobs from the jobs file, if any. Jobs that can't
+// be configured are reported and left out, while a file that can't be read
+// is returned as an error so scheduled jobs are kept as they are
+func queryFileJobs(client ContainerClient) ([]ContainerCronJob, error) {
+	jobs := []ContainerCronJob{}
+
+	if jobsFile == "" {
+		return jobs, nil
+	}
+
+	configs, err := readJobsFile(jobsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, jobName := range sortedKeys(configs) {
+		config := configs[jobName]
+
+		job, err := newRunJob(client, "", jobName, config)
+		if err == nil {
+			err = checkJobsFileFields(jobName, config)
+		}
+
+		if err != nil {
+			logErrorf("Could not configure job %s: %v", job.name, err)
+			health.ObserveJobFailure(job, err)
+
+			continue
+		}
+
+		if job.schedule == "" && !hasDependencies(config) {
+			logWarningf("Job %s has no schedule or dependencies. Skipping", job.name)
+
+			continue
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// checkJobsFileFields checks that a job in the jobs file only uses fields
+// that are valid in labels
+func checkJobsFileFields(jobName string, config map[string]string) error {
+	for _, field := range sortedKeys(config) {
+		if !execLabelRegexp.MatchString(labelPrefix + jobName + "." + field) {
+			return fmt.Errorf("%w: unknown field %q", ErrInvalidLabel, field)
+		}
+	}
+
+	return nil
+}
+
+// readJobsFile reads a JSON object of job names to their settings. Settings
+// use the same fields as labels. Nested objects, such as env, are flattened
+// with dots and arrays, such as exec, are kept as JSON
+func readJobsFile(path string) (map[string]map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open jobs file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+
+	raw := map[string]map[string]interface{}{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("could not read jobs file %s: %w", path, err)
+	}
+
+	configs := map[string]map[string]string{}
+
+	for jobName, fields := range raw {
+		config := map[string]string{}
+
+		for field, value := range fields {
+			if err := flattenJobField(config, field, value); err != nil {
+				return nil, fmt.Errorf("could not read jobs file %s: job %s: %w", path, jobName, err)
+			}
+		}
+
+		configs[jobName] = config
+	}
+
+	return configs, nil
+}
+
+// flattenJobField adds a field from the jobs file to a map of label fields to
+// values
+func flattenJobField(config map[string]string, field string, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		config[field] = v
+	case json.Number:
+		config[field] = v.String()
+	case bool:
+		config[field] = strconv.FormatBool(v)
+	case []interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+
+		config[field] = string(encoded)
+	case map[string]interface{}:
+		for key, nested := range v {
+			if err := flattenJobField(config, field+"."+key, nested); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %s has an unsupported value", ErrInvalidLabel, field)
+	}
+
+	return nil
+}
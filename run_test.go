@@ -0,0 +1,338 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dockerTypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/net/context"
+)
+
+// useSelfContainerID sets the ID of the container dockron runs in for the
+// duration of a test
+func useSelfContainerID(t *testing.T, containerID string) {
+	t.Helper()
+
+	previous := selfContainerID
+	selfContainerID = containerID
+
+	t.Cleanup(func() {
+		selfContainerID = previous
+	})
+}
+
+// TestRunContainerJobs checks that run jobs create a new container, wait for
+// it and remove the containers of old runs
+func TestRunContainerJobs(t *testing.T) {
+	useFastPolling(t)
+
+	jobContext := context.Background()
+	job := ContainerRunJob{
+		ContainerExecJob: ContainerExecJob{
+			ContainerStartJob: ContainerStartJob{
+				name:        "/dockron/backup",
+				containerID: "dockron",
+				context:     jobContext,
+			},
+			shellCommand: "backup --all",
+			env:          []string{"A=1"},
+		},
+		image:   "alpine:3",
+		network: "backend",
+		mounts:  []mount.Mount{{Type: mount.TypeVolume, Source: "data", Target: "/data"}},
+		keep:    1,
+	}
+
+	config := &container.Config{
+		Image:  "alpine:3",
+		Cmd:    []string{"sh", "-c", "backup --all"},
+		Env:    []string{"A=1"},
+		Labels: map[string]string{runJobLabel: "/dockron/backup"},
+	}
+	hostConfig := &container.HostConfig{
+		Mounts:      []mount.Mount{{Type: mount.TypeVolume, Source: "data", Target: "/data"}},
+		NetworkMode: "backend",
+	}
+	createCall := FakeCall{jobContext, config, hostConfig, (*network.NetworkingConfig)(nil), (*ocispec.Platform)(nil), ""}
+	listCall := FakeCall{jobContext, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", runJobLabel+"=/dockron/backup")),
+	}}
+	previousRuns := []dockerTypes.Container{
+		{ID: "old", Created: 1, State: "exited"},
+		{ID: "running", Created: 2, State: "running"},
+		{ID: "new", Created: 4, State: "exited"},
+		{ID: "previous", Created: 3, State: "exited"},
+	}
+
+	cases := []struct {
+		name           string
+		client         *FakeDockerClient
+		expectedStatus string
+		expectedCalls  map[string][]FakeCall
+	}{
+		{
+			name:           "Handle error creating container",
+			expectedStatus: resultError,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerCreate": {{nil, errGeneric}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerCreate": {createCall},
+			},
+		},
+		{
+			name:           "Run a new container and remove old ones",
+			expectedStatus: resultSuccess,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerCreate": {{container.CreateResponse{ID: "new"}, nil}},
+					"ContainerStart":  {{nil}},
+					"ContainerInspect": {
+						{runningContainerInfo, nil},
+						{stoppedContainerInfo, nil},
+					},
+					"ContainerList":   {{previousRuns, nil}},
+					"ContainerRemove": {{nil}, {nil}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerCreate": {createCall},
+				"ContainerStart":  {{jobContext, "new", container.StartOptions{}}},
+				"ContainerInspect": {
+					{jobContext, "new"},
+					{jobContext, "new"},
+				},
+				"ContainerList": {listCall},
+				"ContainerRemove": {
+					{jobContext, "previous", container.RemoveOptions{RemoveVolumes: true}},
+					{jobContext, "old", container.RemoveOptions{RemoveVolumes: true}},
+				},
+			},
+		},
+		{
+			name:           "Pull missing image",
+			expectedStatus: resultFailure,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerCreate": {
+						{nil, errdefs.NotFound(errGeneric)},
+						{container.CreateResponse{ID: "new"}, nil},
+					},
+					"ImagePull":      {{io.NopCloser(strings.NewReader("")), nil}},
+					"ContainerStart": {{nil}},
+					"ContainerInspect": {
+						{dockerTypes.ContainerJSON{
+							ContainerJSONBase: &dockerTypes.ContainerJSONBase{
+								State: &dockerTypes.ContainerState{Running: false, ExitCode: 1},
+							},
+						}, nil},
+					},
+					"ContainerList": {{[]dockerTypes.Container{{ID: "new", State: "exited"}}, nil}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerCreate":  {createCall, createCall},
+				"ImagePull":        {{jobContext, "alpine:3", image.PullOptions{}}},
+				"ContainerStart":   {{jobContext, "new", container.StartOptions{}}},
+				"ContainerInspect": {{jobContext, "new"}},
+				"ContainerList":    {listCall},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			job := job
+			job.client = c.client
+
+			result := job.runOnce(context.Background())
+
+			ErrorUnequal(t, c.expectedStatus, result.Status(), "Unexpected result")
+			c.client.AssertFakeCalls(t, c.expectedCalls, "Failed")
+		})
+	}
+}
+
+// TestQueryRunJobs checks that run jobs are read from the labels of the
+// dockron container and from the jobs file
+func TestQueryRunJobs(t *testing.T) {
+	useSelfContainerID(t, "dockron")
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+
+	err := os.WriteFile(path, []byte(`{
+		"report": {
+			"schedule": "0 6 * * *",
+			"image": "reporter:latest",
+			"exec": ["/report", "--daily"],
+			"env": {"FORMAT": "pdf"},
+			"keep": 2
+		},
+		"invalid": {
+			"schedule": "0 6 * * *",
+			"image": "reporter:latest",
+			"unknown": "field"
+		}
+	}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := jobsFile
+	jobsFile = path
+
+	t.Cleanup(func() {
+		jobsFile = previous
+	})
+
+	client := NewFakeDockerClient()
+	client.FakeResults["ContainerList"] = []FakeResult{
+		{[]dockerTypes.Container{
+			{
+				Names: []string{"/dockron"},
+				ID:    "dockron",
+				Labels: map[string]string{
+					"dockron.backup.schedule": "0 3 * * *",
+					"dockron.backup.image":    "alpine:3",
+					"dockron.backup.command":  "backup",
+					"dockron.backup.mounts":   "/srv/data:/data:ro,backups:/backups",
+					"dockron.backup.network":  "backend",
+					"dockron.backup.logs":     "false",
+					"dockron.reload.schedule": "0 4 * * *",
+					"dockron.reload.image":    "alpine:3",
+					"dockron.reload.signal":   "HUP",
+				},
+			},
+			{
+				Names: []string{"/other"},
+				ID:    "other",
+				Labels: map[string]string{
+					"dockron.backup.schedule": "0 3 * * *",
+					"dockron.backup.image":    "alpine:3",
+				},
+			},
+		}, nil},
+	}
+
+	jobs, err := QueryScheduledJobs(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ErrorUnequal(t, []ContainerCronJob{
+		ContainerRunJob{
+			ContainerExecJob: ContainerExecJob{
+				ContainerStartJob: ContainerStartJob{
+					client:      client,
+					context:     context.Background(),
+					name:        "/dockron/backup",
+					containerID: "dockron",
+					schedule:    "0 3 * * *",
+					disableLogs: true,
+				},
+				shellCommand: "backup",
+			},
+			image:   "alpine:3",
+			network: "backend",
+			mounts: []mount.Mount{
+				{Type: mount.TypeBind, Source: "/srv/data", Target: "/data", ReadOnly: true},
+				{Type: mount.TypeVolume, Source: "backups", Target: "/backups"},
+			},
+		},
+		ContainerRunJob{
+			ContainerExecJob: ContainerExecJob{
+				ContainerStartJob: ContainerStartJob{
+					client:   client,
+					context:  context.Background(),
+					name:     "report",
+					schedule: "0 6 * * *",
+				},
+				env:     []string{"FORMAT=pdf"},
+				execCmd: []string{"/report", "--daily"},
+			},
+			image: "reporter:latest",
+			keep:  2,
+		},
+	}, jobs, "Unexpected run jobs")
+}
+
+// TestResolveSelfContainer checks that the dockron container is resolved to
+// its full ID by ID or name, or by a matching hostname
+func TestResolveSelfContainer(t *testing.T) {
+	containerInfo := func(hostname string) dockerTypes.ContainerJSON {
+		return dockerTypes.ContainerJSON{
+			ContainerJSONBase: &dockerTypes.ContainerJSONBase{ID: "abc123def456"},
+			Config:            &container.Config{Hostname: hostname},
+		}
+	}
+
+	cases := []struct {
+		name        string
+		containerID string
+		hostname    string
+		result      FakeResult
+		lookup      string
+		expected    string
+	}{
+		{"Resolve given name", "dockron", "abc123", FakeResult{containerInfo("custom"), nil}, "dockron", "abc123def456"},
+		{"Resolve matching hostname", "", "abc123", FakeResult{containerInfo("abc123"), nil}, "abc123", "abc123def456"},
+		{"Reject other container found by hostname", "", "abc", FakeResult{containerInfo("abc123"), nil}, "abc", ""},
+		{"Handle missing container", "", "abc123", FakeResult{dockerTypes.ContainerJSON{}, errGeneric}, "abc123", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{"ContainerInspect": {c.result}},
+			}
+
+			ErrorUnequal(t, c.expected, resolveSelfContainer(client, c.containerID, c.hostname), "Unexpected container ID")
+			client.AssertFakeCalls(t, map[string][]FakeCall{
+				"ContainerInspect": {{context.Background(), c.lookup}},
+			}, "Failed")
+		})
+	}
+}
+
+// TestParseMounts checks the parsing of mounts labels
+func TestParseMounts(t *testing.T) {
+	cases := []struct {
+		val      string
+		expected []mount.Mount
+		valid    bool
+	}{
+		{"data:/data", []mount.Mount{{Type: mount.TypeVolume, Source: "data", Target: "/data"}}, true},
+		{
+			"/srv:/srv:ro, /tmp:/tmp:rw",
+			[]mount.Mount{
+				{Type: mount.TypeBind, Source: "/srv", Target: "/srv", ReadOnly: true},
+				{Type: mount.TypeBind, Source: "/tmp", Target: "/tmp"},
+			},
+			true,
+		},
+		{"data", nil, false},
+		{":/data", nil, false},
+		{"data:/data:rx", nil, false},
+		{"data:/data,", nil, false},
+	}
+
+	for _, c := range cases {
+		mounts, err := parseMounts(c.val)
+
+		ErrorUnequal(t, c.valid, err == nil, "Unexpected validity of "+c.val)
+		ErrorUnequal(t, c.expected, mounts, "Unexpected mounts for "+c.val)
+	}
+}
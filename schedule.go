@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Formats of cron expressions that schedules can be parsed with
+const (
+	scheduleFormatStandard = "standard"
+	scheduleFormatSeconds  = "seconds"
+)
+
+// fieldRange is the range of values allowed in a field of a schedule
+type fieldRange struct {
+	min, max int
+}
+
+var (
+	// standardFields are the ranges of the fields of a standard schedule.
+	// Hashed days of the month stop at 28 so they run every month
+	standardFields = []fieldRange{{0, 59}, {0, 23}, {1, 28}, {1, 12}, {0, 6}}
+	// hashedFieldRegexp matches a hashed field with an optional range and step
+	hashedFieldRegexp = regexp.MustCompile(`^H(?:\((\d+)-(\d+)\))?(?:/(\d+))?$`)
+
+	// cronSeconds allows schedules to start with an optional seconds field
+	cronSeconds bool
+	// defaultTimezone is the timezone of jobs without their own. If empty,
+	// the local timezone is used
+	defaultTimezone string
+)
+
+// scheduleFormat returns the name of the format schedules are parsed with
+func scheduleFormat() string {
+	if cronSeconds {
+		return scheduleFormatSeconds
+	}
+
+	return scheduleFormatStandard
+}
+
+// scheduleParser returns the parser used for all schedules
+func scheduleParser() cron.Parser {
+	if cronSeconds {
+		return cron.NewParser(
+			cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+		)
+	}
+
+	return cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+}
+
+// parseTimezone checks the name of a timezone
+func parseTimezone(field, val string) (string, error) {
+	if _, err := time.LoadLocation(val); err != nil {
+		return "", fmt.Errorf("%w: %s %q: %w", ErrInvalidLabel, field, val, err)
+	}
+
+	return val, nil
+}
+
+// hasTimezonePrefix checks if a schedule sets its own timezone
+func hasTimezonePrefix(spec string) bool {
+	return strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=")
+}
+
+// parseSchedule parses a schedule in the given timezone. A timezone set in
+// the schedule itself with CRON_TZ= takes precedence. Hashed fields are
+// replaced with values derived from hashKey
+func parseSchedule(spec, timezone, hashKey string) (cron.Schedule, error) {
+	spec, err := expandHashedFields(spec, hashKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if timezone != "" && !hasTimezonePrefix(spec) {
+		spec = "CRON_TZ=" + timezone + " " + spec
+	}
+
+	schedule, err := scheduleParser().Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: schedule %q: %w", ErrInvalidLabel, spec, err)
+	}
+
+	return schedule, nil
+}
+
+// expandHashedFields replaces Jenkins style hashed fields in a schedule with
+// values derived from hashKey, so jobs with the same schedule run at
+// different but stable times. H picks a value in the range of the field,
+// H(a-b) picks a value from a to b and H/n or H(a-b)/n runs every n starting
+// from a hashed offset
+func expandHashedFields(spec, hashKey string) (string, error) {
+	if !strings.Contains(spec, "H") {
+		return spec, nil
+	}
+
+	prefix := ""
+	if hasTimezonePrefix(spec) {
+		tz, rest, _ := strings.Cut(spec, " ")
+		prefix, spec = tz+" ", rest
+	}
+
+	fields := strings.Fields(spec)
+
+	ranges := standardFields
+	if cronSeconds && len(fields) == len(standardFields)+1 {
+		ranges = append([]fieldRange{{0, 59}}, standardFields...)
+	}
+
+	// Let the parser report schedules with the wrong number of fields
+	if len(fields) != len(ranges) {
+		return prefix + spec, nil
+	}
+
+	for i, field := range fields {
+		parts := strings.Split(field, ",")
+		for j, part := range parts {
+			if !strings.HasPrefix(part, "H") {
+				continue
+			}
+
+			expanded, err := expandHashedField(part, ranges[i], hashValue(hashKey, strconv.Itoa(i)))
+			if err != nil {
+				return "", err
+			}
+
+			parts[j] = expanded
+		}
+
+		fields[i] = strings.Join(parts, ",")
+	}
+
+	return prefix + strings.Join(fields, " "), nil
+}
+
+// expandHashedField replaces a single hashed field with a value in its range
+// chosen by hash
+func expandHashedField(field string, bounds fieldRange, hash uint64) (string, error) {
+	matches := hashedFieldRegexp.FindStringSubmatch(field)
+	if matches == nil {
+		return "", fmt.Errorf("%w: hashed field %q must be in the form H, H(a-b), H/n or H(a-b)/n", ErrInvalidLabel, field)
+	}
+
+	if matches[1] != "" {
+		bounds.min, _ = strconv.Atoi(matches[1])
+		bounds.max, _ = strconv.Atoi(matches[2])
+
+		if bounds.min > bounds.max {
+			return "", fmt.Errorf("%w: hashed field %q has an empty range", ErrInvalidLabel, field)
+		}
+	}
+
+	if matches[3] == "" {
+		return strconv.FormatUint(uint64(bounds.min)+hash%uint64(bounds.max-bounds.min+1), 10), nil
+	}
+
+	step, err := strconv.Atoi(matches[3])
+	if err != nil || step < 1 {
+		return "", fmt.Errorf("%w: hashed field %q must have a positive step", ErrInvalidLabel, field)
+	}
+
+	start := bounds.min + int(hash%uint64(min(step, bounds.max-bounds.min+1)))
+
+	return fmt.Sprintf("%d-%d/%d", start, bounds.max, step), nil
+}
+
+// hashValue returns a stable hash of a key and a salt
+func hashValue(key, salt string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key + "/" + salt))
+
+	return h.Sum64()
+}
+
+// jitterSchedule delays every run of a schedule by a fixed offset
+type jitterSchedule struct {
+	schedule cron.Schedule
+	offset   time.Duration
+}
+
+// Next returns the next run of the schedule after t, delayed by the offset
+func (s jitterSchedule) Next(t time.Time) time.Time {
+	next := s.schedule.Next(t.Add(-s.offset))
+	if next.IsZero() {
+		return next
+	}
+
+	return next.Add(s.offset)
+}
+
+// withJitter delays a schedule by an offset up to jitter that is stable for
+// a given hashKey
+func withJitter(schedule cron.Schedule, jitter time.Duration, hashKey string) cron.Schedule {
+	if jitter <= 0 {
+		return schedule
+	}
+
+	offset := time.Duration(hashValue(hashKey, "jitter") % uint64(jitter)).Truncate(time.Second)
+	if offset == 0 {
+		return schedule
+	}
+
+	return jitterSchedule{schedule: schedule, offset: offset}
+}
+
+// addJob parses the schedule of a job and adds it to the cron
+func addJob(c *cron.Cron, job ContainerCronJob) (cron.EntryID, error) {
+	schedule, err := job.CronSchedule()
+	if err != nil {
+		return 0, err
+	}
+
+	return c.Schedule(schedule, jobRunner{job}), nil
+}
+
+// entryJob returns the job scheduled in a cron entry. This should be safe
+// since jobs are only scheduled with addJob
+func entryJob(entry cron.Entry) ContainerCronJob {
+	return entry.Job.(jobRunner).job
+}
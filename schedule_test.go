@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// TestParseSchedule checks parsing schedules with and without seconds and in
+// different timezones
+func TestParseSchedule(t *testing.T) {
+	defer func(seconds bool) {
+		cronSeconds = seconds
+	}(cronSeconds)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("Timezone data is not available: %v", err)
+	}
+
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name         string
+		seconds      bool
+		spec         string
+		timezone     string
+		expectedNext time.Time
+		expectErr    bool
+	}{
+		{
+			name:         "Standard",
+			spec:         "30 * * * *",
+			expectedNext: time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			name:         "Descriptor",
+			spec:         "@daily",
+			expectedNext: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "Seconds without seconds mode",
+			spec:      "15 30 * * * *",
+			expectErr: true,
+		},
+		{
+			name:         "Seconds",
+			seconds:      true,
+			spec:         "15 30 * * * *",
+			expectedNext: time.Date(2024, 1, 1, 12, 30, 15, 0, time.UTC),
+		},
+		{
+			name:         "Seconds mode without seconds",
+			seconds:      true,
+			spec:         "30 * * * *",
+			expectedNext: time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			name:         "Timezone",
+			spec:         "0 9 * * *",
+			timezone:     "America/New_York",
+			expectedNext: time.Date(2024, 1, 1, 9, 0, 0, 0, newYork),
+		},
+		{
+			name:         "Timezone in schedule",
+			spec:         "CRON_TZ=UTC 0 9 * * *",
+			timezone:     "America/New_York",
+			expectedNext: time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "Invalid",
+			spec:      "every minute",
+			expectErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cronSeconds = c.seconds
+
+			schedule, err := parseSchedule(c.spec, c.timezone, "job")
+			if c.expectErr {
+				if !errors.Is(err, ErrInvalidLabel) {
+					t.Errorf("Expected an invalid label error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if next := schedule.Next(from); !next.Equal(c.expectedNext) {
+				t.Errorf("Expected next run at %s, got %s", c.expectedNext, next)
+			}
+		})
+	}
+}
+
+// TestScheduleWithTimezone checks that jobs are added to the cron in their
+// own timezone or the default timezone
+func TestScheduleWithTimezone(t *testing.T) {
+	defer func(timezone string) {
+		defaultTimezone = timezone
+	}(defaultTimezone)
+
+	if _, err := time.LoadLocation("Asia/Tokyo"); err != nil {
+		t.Skipf("Timezone data is not available: %v", err)
+	}
+
+	defaultTimezone = "Asia/Tokyo"
+
+	croner := cron.New()
+	ScheduleJobs(croner, []ContainerCronJob{
+		ContainerStartJob{name: "default", containerID: "default", schedule: "0 9 * * *"},
+		ContainerStartJob{name: "utc", containerID: "utc", schedule: "0 9 * * *", timezone: "UTC"},
+	})
+	croner.Start()
+	defer croner.Stop()
+
+	for _, entry := range croner.Entries() {
+		job := entryJob(entry)
+		location, _ := time.LoadLocation(job.Timezone())
+
+		if next := entry.Next.In(location); next.Hour() != 9 || next.Minute() != 0 {
+			t.Errorf("Expected %s to run at 09:00 %s, got %s", job.Name(), job.Timezone(), next)
+		}
+	}
+
+	ErrorUnequal(t, 2, len(croner.Entries()), "Expected both jobs to be scheduled")
+}
+
+// TestExpandHashedFields checks that hashed fields are replaced with stable
+// values in the range of each field
+func TestExpandHashedFields(t *testing.T) {
+	cases := []struct {
+		name      string
+		spec      string
+		key       string
+		expected  string
+		expectErr bool
+	}{
+		{"No hashed fields", "0 * * * THU", "job", "0 * * * THU", false},
+		{"Descriptor", "@hourly", "job", "@hourly", false},
+		{"Hashed minute", "H * * * *", "job_1", "51 * * * *", false},
+		{"Hashed minute for another job", "H * * * *", "job_2", "6 * * * *", false},
+		{"Hashed range", "0 H(1-5) * * *", "job_1", "0 1 * * *", false},
+		{"Hashed step", "H/15 * * * *", "job_1", "6-59/15 * * * *", false},
+		{"Hashed range and step", "0 H(9-17)/4 * * *", "job_1", "0 9-17/4 * * *", false},
+		{"Hashed list", "H,30 * * * *", "job_1", "51,30 * * * *", false},
+		{"Timezone", "CRON_TZ=UTC H 3 * * *", "job_1", "CRON_TZ=UTC 51 3 * * *", false},
+		{"Invalid hashed field", "Hx * * * *", "job_1", "", true},
+		{"Empty range", "H(5-1) * * * *", "job_1", "", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expanded, err := expandHashedFields(c.spec, c.key)
+			if c.expectErr {
+				if !errors.Is(err, ErrInvalidLabel) {
+					t.Errorf("Expected an invalid label error, got %v", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			ErrorUnequal(t, c.expected, expanded, "Unexpected expanded schedule")
+
+			if _, err := parseSchedule(c.spec, "", c.key); err != nil {
+				t.Errorf("Unexpected error parsing expanded schedule: %v", err)
+			}
+		})
+	}
+}
+
+// TestJitter checks that jitter delays every run by the same offset
+func TestJitter(t *testing.T) {
+	job := ContainerStartJob{name: "jitter", containerID: "jitter", schedule: "0 * * * *", jitter: 10 * time.Minute}
+
+	schedule, err := job.CronSchedule()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	from := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+	first := schedule.Next(from)
+	offset := first.Sub(from)
+
+	if offset <= 0 || offset >= job.jitter || offset%time.Second != 0 {
+		t.Fatalf("Expected a whole second offset under %s, got %s", job.jitter, offset)
+	}
+
+	ErrorUnequal(t, from.Add(time.Hour+offset), schedule.Next(first), "Expected the same offset for the next run")
+	ErrorUnequal(t, first, schedule.Next(from.Add(offset-time.Second)), "Expected the delayed run before the offset")
+
+	again, _ := job.CronSchedule()
+	ErrorUnequal(t, first, again.Next(from), "Expected a stable offset")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"git.iamthefij.com/iamthefij/slog"
+)
+
+// apiToken is the token required to act on jobs over the HTTP API. Anyone
+// who can reach the API may act on jobs if empty
+var apiToken string
+
+// NewServeMux creates the handler for the HTTP API and health checks
+func NewServeMux(api *API) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", health.HandleHealthz)
+	mux.HandleFunc("GET /readyz", health.HandleReadyz)
+	mux.HandleFunc("GET /jobs", api.HandleListJobs)
+	mux.HandleFunc("GET /jobs/{name}", api.HandleGetJob)
+	mux.HandleFunc("GET /jobs/{name}/runs", api.HandleListRuns)
+	mux.HandleFunc("POST /jobs/{name}/run", requireToken(api.HandleRunJob))
+	mux.HandleFunc("POST /jobs/{name}/pause", requireToken(api.HandlePauseJob))
+	mux.HandleFunc("POST /jobs/{name}/resume", requireToken(api.HandleResumeJob))
+
+	return mux
+}
+
+// requireToken wraps a handler that acts on jobs so that it requires apiToken
+// as a bearer token, if set
+func requireToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		expected := []byte("Bearer " + apiToken)
+		if apiToken != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeJSON(w, http.StatusUnauthorized, apiError{"invalid or missing api token"})
+
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// StartHTTPServers starts serving the HTTP API and metrics in the background
+// on their respective addresses. Either is disabled if its address is empty.
+// If both addresses are the same, a single server is used
+func StartHTTPServers(httpAddr, metricsAddr string, api *API) {
+	if httpAddr != "" {
+		mux := NewServeMux(api)
+
+		if metricsAddr == httpAddr {
+			mux.Handle("GET /metrics", metrics)
+
+			metricsAddr = ""
+		}
+
+		go listenAndServe("HTTP API", httpAddr, mux)
+	}
+
+	if metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics)
+
+		go listenAndServe("metrics", metricsAddr, mux)
+	}
+}
+
+// listenAndServe serves a handler on the given address until it fails
+func listenAndServe(name, addr string, handler http.Handler) {
+	logInfof("Serving %s on %s", name, addr)
+
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: httpReadHeaderTimeout}
+	slog.OnErrPanicf(server.ListenAndServe(), "Could not serve %s", name)
+}
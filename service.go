@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"golang.org/x/net/context"
+)
+
+// restartJobName is the name of the job in dockron.<job> labels that
+// restarts the container
+const restartJobName = "restart"
+
+// Fields of the dockron.<field> labels that start and stop a long running
+// container on a schedule
+const (
+	startScheduleField = "start_schedule"
+	stopScheduleField  = "stop_schedule"
+)
+
+// signalRegexp matches the name of a signal with the SIG prefix
+var signalRegexp = regexp.MustCompile(`^SIG[A-Z][A-Z0-9+-]*$`)
+
+// ContainerRestartJob is a scheduled job that restarts a long running
+// container
+type ContainerRestartJob struct {
+	ContainerStartJob
+}
+
+// Type returns the type of the job
+func (job ContainerRestartJob) Type() string {
+	return "restart"
+}
+
+// runOnce restarts the container if it is running. Stopped containers are
+// left stopped
+func (job ContainerRestartJob) runOnce(runCtx context.Context) JobResult {
+	logEvent(levelInfo, jobFields(job, eventStarted), "Restarting: %s", job.name)
+
+	if result, ok := job.skipUnlessRunning("restart"); !ok {
+		return result
+	}
+
+	markRunStarted(runCtx)
+
+	err := job.client.ContainerRestart(runCtx, job.containerID, container.StopOptions{})
+	if err != nil {
+		if ctxErr := runCtx.Err(); ctxErr != nil {
+			return interruptedResult(ctxErr)
+		}
+
+		return job.errorResult("restart container", err)
+	}
+
+	return JobResult{}
+}
+
+// ContainerSignalJob is a scheduled job that sends a signal to the main
+// process of a long running container
+type ContainerSignalJob struct {
+	ContainerStartJob
+	signal string
+}
+
+// Type returns the type of the job
+func (job ContainerSignalJob) Type() string {
+	return "signal"
+}
+
+// runOnce sends the signal to the container if it is running
+func (job ContainerSignalJob) runOnce(runCtx context.Context) JobResult {
+	logEvent(levelInfo, jobFields(job, eventStarted), "Sending %s: %s", job.signal, job.name)
+
+	if result, ok := job.skipUnlessRunning("signal"); !ok {
+		return result
+	}
+
+	markRunStarted(runCtx)
+
+	err := job.client.ContainerKill(runCtx, job.containerID, job.signal)
+	if err != nil {
+		return job.errorResult("signal container", err)
+	}
+
+	return JobResult{}
+}
+
+// ContainerStartServiceJob is a scheduled job that starts a long running
+// container without waiting for it to exit
+type ContainerStartServiceJob struct {
+	ContainerStartJob
+}
+
+// Type returns the type of the job
+func (job ContainerStartServiceJob) Type() string {
+	return "service_start"
+}
+
+// runOnce starts the container unless it is already running. The container
+// is left running
+func (job ContainerStartServiceJob) runOnce(runCtx context.Context) JobResult {
+	logEvent(levelInfo, jobFields(job, eventStarted), "Starting service: %s", job.name)
+
+	containerJSON, err := job.client.ContainerInspect(job.context, job.containerID)
+	if err != nil {
+		return job.errorResult("get container details", err)
+	}
+
+	if containerJSON.State.Running {
+		logEvent(levelInfo, jobFields(job, eventSkipped), "%s: Container is already running. Skipping start.", job.name)
+
+		return JobResult{Skipped: true}
+	}
+
+	markRunStarted(runCtx)
+
+	err = job.client.ContainerStart(runCtx, job.containerID, container.StartOptions{})
+	if err != nil {
+		if ctxErr := runCtx.Err(); ctxErr != nil {
+			return interruptedResult(ctxErr)
+		}
+
+		return job.errorResult("start container", err)
+	}
+
+	return JobResult{}
+}
+
+// ContainerStopServiceJob is a scheduled job that gracefully stops a long
+// running container
+type ContainerStopServiceJob struct {
+	ContainerStartJob
+	// stopTimeout is the time to wait for the container to exit before it is
+	// killed. Defaults to the stop timeout of the container
+	stopTimeout time.Duration
+}
+
+// Type returns the type of the job
+func (job ContainerStopServiceJob) Type() string {
+	return "service_stop"
+}
+
+// runOnce stops the container if it is running, killing it if it has not
+// exited once the stop timeout is exceeded
+func (job ContainerStopServiceJob) runOnce(runCtx context.Context) JobResult {
+	logEvent(levelInfo, jobFields(job, eventStarted), "Stopping service: %s", job.name)
+
+	if result, ok := job.skipUnlessRunning("stop"); !ok {
+		return result
+	}
+
+	markRunStarted(runCtx)
+
+	options := container.StopOptions{}
+	if job.stopTimeout > 0 {
+		timeout := int(math.Ceil(job.stopTimeout.Seconds()))
+		options.Timeout = &timeout
+	}
+
+	err := job.client.ContainerStop(runCtx, job.containerID, options)
+	if err != nil {
+		if ctxErr := runCtx.Err(); ctxErr != nil {
+			return interruptedResult(ctxErr)
+		}
+
+		return job.errorResult("stop container", err)
+	}
+
+	return JobResult{}
+}
+
+// newServiceWindowJob builds a job that starts or stops a container from the
+// given schedule field and a map of label fields to values
+func newServiceWindowJob(job ContainerStartJob, field string, config map[string]string) (ContainerCronJob, error) {
+	job.schedule = config[field]
+
+	// Name the job after its label so it doesn't clash with exec jobs
+	job.name += "/" + field
+
+	if field == startScheduleField {
+		startJob := ContainerStartServiceJob{job}
+
+		return startJob, configureServiceWindowJob(&startJob.ContainerStartJob, config)
+	}
+
+	stopJob := ContainerStopServiceJob{ContainerStartJob: job}
+
+	if err := configureServiceWindowJob(&stopJob.ContainerStartJob, config); err != nil {
+		return stopJob, err
+	}
+
+	if val, ok := config["stop_timeout"]; ok {
+		var err error
+		if stopJob.stopTimeout, err = parseDurationLabel("stop_timeout", val); err != nil {
+			return stopJob, err
+		}
+	}
+
+	return stopJob, nil
+}
+
+// configureServiceWindowJob applies the settings shared by all job types to
+// a job starting or stopping a container
+func configureServiceWindowJob(job *ContainerStartJob, config map[string]string) error {
+	if _, ok := config["schedule"]; ok {
+		return fmt.Errorf(
+			"%w: %s and %s can't be used with schedule as the container would be started and waited on",
+			ErrInvalidLabel,
+			startScheduleField,
+			stopScheduleField,
+		)
+	}
+
+	if job.schedule == "" {
+		return fmt.Errorf("%w: schedule must not be empty", ErrInvalidLabel)
+	}
+
+	return configureJob(job, config)
+}
+
+// skipUnlessRunning checks that the job container is running. If not, the
+// result of the skipped or failed run is returned
+func (job ContainerStartJob) skipUnlessRunning(action string) (JobResult, bool) {
+	containerJSON, err := job.client.ContainerInspect(job.context, job.containerID)
+	if err != nil {
+		return job.errorResult("get container details", err), false
+	}
+
+	if !containerJSON.State.Running {
+		logEvent(levelWarning, jobFields(job, eventSkipped), "%s: Container not running. Skipping %s.", job.name, action)
+
+		return JobResult{Skipped: true}, false
+	}
+
+	return JobResult{}, true
+}
+
+// isServiceJob checks if the fields of a dockron.<job> label configure a
+// restart or signal job rather than an exec job
+func isServiceJob(jobName string, config map[string]string) bool {
+	if _, ok := config["signal"]; ok {
+		return true
+	}
+
+	_, hasCommand := config["command"]
+	_, hasExec := config["exec"]
+
+	return jobName == restartJobName && !hasCommand && !hasExec
+}
+
+// newServiceJob builds a restart or signal job from a map of label fields to
+// values
+func newServiceJob(job ContainerStartJob, config map[string]string) (ContainerCronJob, error) {
+	err := configureJob(&job, config)
+
+	val, ok := config["signal"]
+	if !ok {
+		return ContainerRestartJob{job}, err
+	}
+
+	signalJob := ContainerSignalJob{ContainerStartJob: job}
+	if err != nil {
+		return signalJob, err
+	}
+
+	_, hasCommand := config["command"]
+	_, hasExec := config["exec"]
+
+	if hasCommand || hasExec {
+		return signalJob, fmt.Errorf("%w: signal can't be used with command or exec", ErrInvalidLabel)
+	}
+
+	signalJob.signal, err = parseSignal(val)
+
+	return signalJob, err
+}
+
+// parseSignal parses the name or number of a signal. Names are normalized to
+// upper case with the SIG prefix, eg. hup becomes SIGHUP
+func parseSignal(val string) (string, error) {
+	if number, err := strconv.Atoi(val); err == nil {
+		if number < 1 || number > 64 {
+			return "", fmt.Errorf("%w: signal %q must be between 1 and 64", ErrInvalidLabel, val)
+		}
+
+		return val, nil
+	}
+
+	signal := strings.ToUpper(strings.TrimSpace(val))
+	if !strings.HasPrefix(signal, "SIG") {
+		signal = "SIG" + signal
+	}
+
+	if !signalRegexp.MatchString(signal) {
+		return "", fmt.Errorf("%w: signal %q must be a signal name or number, eg. SIGHUP", ErrInvalidLabel, val)
+	}
+
+	return signal, nil
+}
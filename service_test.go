@@ -0,0 +1,223 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"golang.org/x/net/context"
+)
+
+// TestRunServiceJobs checks that restart and signal jobs act on running
+// containers and skip stopped ones
+func TestRunServiceJobs(t *testing.T) {
+	jobContext := context.Background()
+	runCtx := context.Background()
+	base := ContainerStartJob{
+		name:        "service/job",
+		containerID: "service",
+		context:     jobContext,
+	}
+
+	cases := []struct {
+		name string
+		// signal is the signal sent by a signal job. If empty, the
+		// container is restarted
+		signal         string
+		client         *FakeDockerClient
+		expectedStatus string
+		expectedCalls  map[string][]FakeCall
+	}{
+		{
+			name:           "Restart running container",
+			expectedStatus: resultSuccess,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerInspect": {{runningContainerInfo, nil}},
+					"ContainerRestart": {{nil}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerInspect": {{jobContext, "service"}},
+				"ContainerRestart": {{runCtx, "service", container.StopOptions{}}},
+			},
+		},
+		{
+			name:           "Skip restarting stopped container",
+			expectedStatus: resultSkipped,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerInspect": {{stoppedContainerInfo, nil}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerInspect": {{jobContext, "service"}},
+			},
+		},
+		{
+			name:           "Handle error restarting container",
+			expectedStatus: resultError,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerInspect": {{runningContainerInfo, nil}},
+					"ContainerRestart": {{errGeneric}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerInspect": {{jobContext, "service"}},
+				"ContainerRestart": {{runCtx, "service", container.StopOptions{}}},
+			},
+		},
+		{
+			name:           "Signal running container",
+			signal:         "SIGHUP",
+			expectedStatus: resultSuccess,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerInspect": {{runningContainerInfo, nil}},
+					"ContainerKill":    {{nil}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerInspect": {{jobContext, "service"}},
+				"ContainerKill":    {{runCtx, "service", "SIGHUP"}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			job := base
+			job.client = c.client
+
+			var result JobResult
+			if c.signal == "" {
+				result = ContainerRestartJob{job}.runOnce(runCtx)
+			} else {
+				result = ContainerSignalJob{ContainerStartJob: job, signal: c.signal}.runOnce(runCtx)
+			}
+
+			ErrorUnequal(t, c.expectedStatus, result.Status(), "Unexpected result")
+			c.client.AssertFakeCalls(t, c.expectedCalls, "Failed")
+		})
+	}
+}
+
+// TestParseSignal checks the parsing of signal labels
+func TestParseSignal(t *testing.T) {
+	cases := []struct {
+		val      string
+		expected string
+		valid    bool
+	}{
+		{"SIGHUP", "SIGHUP", true},
+		{"hup", "SIGHUP", true},
+		{"SIGRTMIN+3", "SIGRTMIN+3", true},
+		{"9", "9", true},
+		{"0", "", false},
+		{"SIG HUP", "", false},
+		{"", "", false},
+	}
+
+	for _, c := range cases {
+		signal, err := parseSignal(c.val)
+
+		ErrorUnequal(t, c.valid, err == nil, "Unexpected validity of "+c.val)
+		ErrorUnequal(t, c.expected, signal, "Unexpected signal for "+c.val)
+	}
+}
+
+// TestRunServiceWindowJobs checks that service start and stop jobs only act
+// on containers that are not already in the desired state
+func TestRunServiceWindowJobs(t *testing.T) {
+	jobContext := context.Background()
+	runCtx, cancel := context.WithCancel(jobContext)
+
+	defer cancel()
+	base := ContainerStartJob{
+		name:        "service",
+		containerID: "service",
+		context:     jobContext,
+	}
+	stopTimeout := 30
+
+	cases := []struct {
+		name           string
+		stop           bool
+		client         *FakeDockerClient
+		expectedStatus string
+		expectedCalls  map[string][]FakeCall
+	}{
+		{
+			name:           "Start stopped container",
+			expectedStatus: resultSuccess,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerInspect": {{stoppedContainerInfo, nil}},
+					"ContainerStart":   {{nil}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerInspect": {{jobContext, "service"}},
+				"ContainerStart":   {{runCtx, "service", container.StartOptions{}}},
+			},
+		},
+		{
+			name:           "Skip starting running container",
+			expectedStatus: resultSkipped,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerInspect": {{runningContainerInfo, nil}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerInspect": {{jobContext, "service"}},
+			},
+		},
+		{
+			name:           "Stop running container",
+			stop:           true,
+			expectedStatus: resultSuccess,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerInspect": {{runningContainerInfo, nil}},
+					"ContainerStop":    {{nil}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerInspect": {{jobContext, "service"}},
+				"ContainerStop":    {{runCtx, "service", container.StopOptions{Timeout: &stopTimeout}}},
+			},
+		},
+		{
+			name:           "Skip stopping stopped container",
+			stop:           true,
+			expectedStatus: resultSkipped,
+			client: &FakeDockerClient{
+				FakeResults: map[string][]FakeResult{
+					"ContainerInspect": {{stoppedContainerInfo, nil}},
+				},
+			},
+			expectedCalls: map[string][]FakeCall{
+				"ContainerInspect": {{jobContext, "service"}},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			job := base
+			job.client = c.client
+
+			var result JobResult
+			if c.stop {
+				result = ContainerStopServiceJob{ContainerStartJob: job, stopTimeout: 30 * time.Second}.runOnce(runCtx)
+			} else {
+				result = ContainerStartServiceJob{job}.runOnce(runCtx)
+			}
+
+			ErrorUnequal(t, c.expectedStatus, result.Status(), "Unexpected result")
+			c.client.AssertFakeCalls(t, c.expectedCalls, "Failed")
+		})
+	}
+}